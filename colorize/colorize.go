@@ -5,6 +5,8 @@ import (
 	"os"            
 	"path/filepath" 
 	"strings"       
+
+	"eles/utils"
 )
 
 //Check if a given file name corresponds to an image file.
@@ -68,3 +70,26 @@ func ColorizeName(file fs.DirEntry, info os.FileInfo, capture bool) string {
 	
 	return name     //plain file
 }
+
+// Return the name of a symlink whose target is missing or loops, using
+// the GNU "or" color (bold red on black).
+func ColorizeOrphan(name string, capture bool) string {
+	if capture {
+		return name
+	}
+	return "\033[40;31;01m" + name + "\033[0m"
+}
+
+// Return a link target that does not exist, using the GNU "mi" color
+// (blinking white on red).
+func ColorizeMissing(target string, capture bool) string {
+	if capture {
+		return target
+	}
+	return "\033[01;05;37;41m" + target + "\033[0m"
+}
+
+// Return a link target colored according to the type of the file it names.
+func ColorizePath(target string, info os.FileInfo, capture bool) string {
+	return ColorizeName(utils.NewPseudoDirEntry(info, target), info, capture)
+}
@@ -0,0 +1,283 @@
+package completion
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"eles/flags"
+)
+
+// Print writes the completion script for shell ("bash", "zsh" or "fish")
+// to w. The scripts are generated from flags.Table and flags.Commands, so
+// they offer exactly the subcommands, options, --no- forms and value
+// choices the parser accepts, and complete paths everywhere else.
+func Print(shell string, w io.Writer) {
+	switch shell {
+	case "bash":
+		printBash(w)
+	case "zsh":
+		printZsh(w)
+	case "fish":
+		printFish(w)
+	}
+}
+
+// optionWords returns the words completed for an argument starting with
+// "-" among options: short options, long options ("--name=" when a value
+// must follow) and the --no- forms.
+func optionWords(options []flags.Option) []string {
+	var words []string
+	for _, option := range options {
+		if option.Short != 0 {
+			words = append(words, "-"+string(option.Short))
+		}
+		if option.Name == "" {
+			continue
+		}
+		if option.Value == "" || option.Optional {
+			words = append(words, "--"+option.Name)
+		}
+		if option.Value != "" {
+			words = append(words, "--"+option.Name+"=")
+		}
+		if negated := negation(option); negated != "" {
+			words = append(words, "--"+negated)
+		}
+	}
+	return words
+}
+
+// commandNames returns the names of the subcommands.
+func commandNames() []string {
+	var names []string
+	for _, command := range flags.Commands() {
+		names = append(names, command.Name)
+	}
+	return names
+}
+
+// negation returns the long name of the --no- form of option, or "" when
+// it has none. The double negation of --no-clobber is left out.
+func negation(option flags.Option) string {
+	if !option.Negatable() || strings.HasPrefix(option.Name, "no-") {
+		return ""
+	}
+	return "no-" + option.Name
+}
+
+// valueMessage returns the name zsh shows for the value of option.
+func valueMessage(option flags.Option) string {
+	if option.File {
+		return "file"
+	}
+	return strings.ToLower(option.Value)
+}
+
+func printBash(w io.Writer) {
+	fmt.Fprintln(w, "# bash completion for myls, generated by myls --completion=bash.")
+	fmt.Fprintln(w, "# Load it with: source <(myls --completion=bash)")
+	fmt.Fprintln(w, "_myls() {")
+	fmt.Fprintln(w, `    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} option= value= words= command=`)
+	fmt.Fprintln(w, `    # Bash splits words at "=", so --sort=ti arrives as "--sort" "=" "ti".`)
+	fmt.Fprintln(w, `    if [[ $cur == = ]]; then`)
+	fmt.Fprintln(w, `        option=$prev`)
+	fmt.Fprintln(w, `    elif [[ $prev == = && $COMP_CWORD -ge 2 ]]; then`)
+	fmt.Fprintln(w, `        option=${COMP_WORDS[COMP_CWORD-2]} value=$cur`)
+	fmt.Fprintln(w, `    elif [[ $prev == -? ]]; then`)
+	fmt.Fprintln(w, `        option=$prev value=$cur`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `    # A first word naming a command, and no file, selects its options.`)
+	fmt.Fprintln(w, `    [[ $COMP_CWORD -gt 1 && ! -e ${COMP_WORDS[1]} ]] && command=${COMP_WORDS[1]}`)
+	fmt.Fprintln(w, `    case $command in`)
+	for _, command := range flags.Commands() {
+		fmt.Fprintf(w, "    %s)\n", command.Name)
+		printBashOptions(w, command.Table())
+	}
+	fmt.Fprintln(w, `    *)`)
+	printBashOptions(w, flags.Table())
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w, `    if [[ $cur == -* ]]; then`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -W "$words" -- "$cur"))`)
+	fmt.Fprintln(w, `        [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *= ]] && compopt -o nospace`)
+	fmt.Fprintln(w, `        return`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `    if [[ $COMP_CWORD -eq 1 ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, `        return`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `    COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _myls myls")
+}
+
+// printBashOptions prints the arm of the command case completing the
+// values of options and setting the option words.
+func printBashOptions(w io.Writer, options []flags.Option) {
+	fmt.Fprintln(w, `        case $option in`)
+	var fileOptions, freeOptions []string
+	for _, option := range options {
+		if option.Value == "" {
+			continue
+		}
+		var names []string
+		if option.Name != "" {
+			names = append(names, "--"+option.Name)
+		}
+		// Short options never take an optional value.
+		if option.Short != 0 && !option.Optional {
+			names = append(names, "-"+string(option.Short))
+		}
+		switch {
+		case option.File:
+			fileOptions = append(fileOptions, names...)
+		case len(option.Choices) > 0:
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W %q -- \"$value\")); return ;;\n", strings.Join(names, "|"), strings.Join(option.Choices, " "))
+		default:
+			freeOptions = append(freeOptions, names...)
+		}
+	}
+	if len(fileOptions) > 0 {
+		fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -f -- \"$value\")); return ;;\n", strings.Join(fileOptions, "|"))
+	}
+	// Numbers, sizes, patterns and names have nothing to complete.
+	if len(freeOptions) > 0 {
+		fmt.Fprintf(w, "        %s) COMPREPLY=(); return ;;\n", strings.Join(freeOptions, "|"))
+	}
+	fmt.Fprintln(w, `        esac`)
+	fmt.Fprintf(w, "        words=%q\n", strings.Join(optionWords(options), " "))
+	fmt.Fprintln(w, `        ;;`)
+}
+
+func printZsh(w io.Writer) {
+	fmt.Fprintln(w, "#compdef myls")
+	fmt.Fprintln(w, "# zsh completion for myls, generated by myls --completion=zsh.")
+	fmt.Fprintln(w, "# Save it as _myls in a directory of $fpath, or load it with: source <(myls --completion=zsh)")
+	fmt.Fprintln(w, "_myls() {")
+	fmt.Fprintln(w, "    # A first word naming a command, and no file, selects its options.")
+	fmt.Fprintln(w, "    if (( CURRENT > 2 )) && [[ ! -e ${words[2]} ]]; then")
+	fmt.Fprintln(w, "        case ${words[2]} in")
+	for _, command := range flags.Commands() {
+		fmt.Fprintf(w, "        %s)\n", command.Name)
+		fmt.Fprintln(w, "            shift words; (( CURRENT-- ))")
+		printZshArguments(w, "            ", command.Table())
+		fmt.Fprintln(w, "            return ;;")
+	}
+	fmt.Fprintln(w, "        esac")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, "    if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then")
+	var commands []string
+	for _, command := range flags.Commands() {
+		commands = append(commands, command.Name+`\:"`+zshQuote(command.Help)+`"`)
+	}
+	fmt.Fprintf(w, "        _alternative 'commands:command:((%s))' 'files:file:_files'\n", strings.Join(commands, " "))
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    fi")
+	printZshArguments(w, "    ", flags.Table())
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, `if [[ $funcstack[1] == _myls ]]; then _myls "$@"; else compdef _myls myls; fi`)
+}
+
+// printZshArguments prints the _arguments call completing options, and
+// files after them, each line starting with indent.
+func printZshArguments(w io.Writer, indent string, options []flags.Option) {
+	fmt.Fprintf(w, "%s_arguments -s -S \\\n", indent)
+	for _, option := range options {
+		// The description follows the option name and the "=-" or "+" of
+		// its value, the value follows the description.
+		description := "[" + zshQuote(option.Help) + "]"
+		if option.Short != 0 {
+			spec := "-" + string(option.Short)
+			if option.Value != "" && !option.Optional {
+				spec += "+" + description + ":" + valueMessage(option) + ":" + zshAction(option)
+			} else {
+				spec += description
+			}
+			fmt.Fprintf(w, "%s    '%s' \\\n", indent, spec)
+		}
+		if option.Name == "" {
+			continue
+		}
+		spec := "--" + option.Name
+		switch {
+		case option.Value != "" && option.Optional:
+			spec += "=-" + description + "::" + valueMessage(option) + ":" + zshAction(option)
+		case option.Value != "":
+			spec += "=-" + description + ":" + valueMessage(option) + ":" + zshAction(option)
+		default:
+			spec += description
+		}
+		fmt.Fprintf(w, "%s    '%s' \\\n", indent, spec)
+		if negated := negation(option); negated != "" {
+			fmt.Fprintf(w, "%s    '--%s[undo --%s]' \\\n", indent, negated, option.Name)
+		}
+	}
+	fmt.Fprintf(w, "%s    '*:file:_files'\n", indent)
+}
+
+// zshQuote escapes text for a description within a single quoted
+// _arguments spec.
+func zshQuote(text string) string {
+	text = strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(text)
+	return strings.ReplaceAll(text, "'", `'\''`)
+}
+
+// zshAction returns the _arguments action completing the value of option.
+func zshAction(option flags.Option) string {
+	switch {
+	case option.File:
+		return "_files"
+	case len(option.Choices) > 0:
+		return "(" + strings.Join(option.Choices, " ") + ")"
+	}
+	return " "
+}
+
+func printFish(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for myls, generated by myls --completion=fish.")
+	fmt.Fprintln(w, "# Save it as myls.fish in ~/.config/fish/completions, or load it with: myls --completion=fish | source")
+	fmt.Fprintln(w, "complete -c myls -e")
+	names := strings.Join(commandNames(), " ")
+	for _, command := range flags.Commands() {
+		fmt.Fprintf(w, "complete -c myls -n __fish_use_subcommand -a %s -d %s\n", command.Name, fishQuote(command.Help))
+	}
+	printFishOptions(w, "not __fish_seen_subcommand_from "+names, flags.Table())
+	for _, command := range flags.Commands() {
+		printFishOptions(w, "__fish_seen_subcommand_from "+command.Name, command.Table())
+	}
+}
+
+// printFishOptions prints the completions of options, offered when the
+// condition holds.
+func printFishOptions(w io.Writer, condition string, options []flags.Option) {
+	for _, option := range options {
+		line := "complete -c myls -n " + fishQuote(condition)
+		if option.Short != 0 {
+			line += " -s " + string(option.Short)
+		}
+		if option.Name != "" {
+			line += " -l " + option.Name
+		}
+		switch {
+		case option.Value == "":
+		case option.File:
+			line += " -r -F"
+		case option.Optional && len(option.Choices) == 0:
+		case option.Optional:
+			line += " -f -a '" + strings.Join(option.Choices, " ") + "'"
+		case len(option.Choices) > 0:
+			line += " -x -a '" + strings.Join(option.Choices, " ") + "'"
+		default:
+			line += " -x"
+		}
+		fmt.Fprintln(w, line+" -d "+fishQuote(option.Help))
+		if negated := negation(option); negated != "" {
+			fmt.Fprintf(w, "complete -c myls -n %s -l %s -d %s\n", fishQuote(condition), negated, fishQuote("Undo --"+option.Name))
+		}
+	}
+}
+
+// fishQuote returns text as a single quoted fish string.
+func fishQuote(text string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(text) + "'"
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"eles/flags"
+	"eles/status"
+)
+
+// EnvironmentVariable holds default options, written as on the command line.
+const EnvironmentVariable = "MYLS_OPTIONS"
+
+// File is a parsed configuration file: the options applied to every run
+// and the named profiles, each as command line arguments.
+type File struct {
+	Defaults []string
+	Profiles map[string][]string
+}
+
+// Path returns the configuration file: $XDG_CONFIG_HOME/myls/config.toml,
+// or ~/.config/myls/config.toml when XDG_CONFIG_HOME is not set.
+func Path() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "myls", "config.toml")
+}
+
+// TrustPath returns the file recording the trusted .mylsrc files, next to
+// the configuration file.
+func TrustPath() string {
+	configPath := Path()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), "trusted")
+}
+
+// Defaults returns the options to parse before the command line arguments:
+// the defaults of the configuration file, then the selected --profile,
+// then MYLS_OPTIONS, so each source overrides the ones before it and the
+// command line all of them (built-in < config < profile < environment <
+// command line). With --no-config the configuration file and its profiles
+// are not read. Invalid configuration ends the run with exit status 2.
+func Defaults(arguments []string) []string {
+	environment, err := SplitWords(os.Getenv(EnvironmentVariable))
+	if err == nil {
+		err = checkOptionsOnly(environment)
+	}
+	if err != nil {
+		fail(EnvironmentVariable, err)
+	}
+
+	noConfig, profile, err := selection(append(append([]string{}, environment...), optionArguments(arguments)...))
+	if err != nil {
+		fail("--profile", err)
+	}
+
+	var combined []string
+	if !noConfig {
+		configPath := Path()
+		configFile, err := Load(configPath)
+		if err != nil {
+			fail(configPath, err)
+		}
+		combined = append(combined, configFile.Defaults...)
+		if profile != "" {
+			profileArguments, ok := configFile.Profiles[profile]
+			if !ok {
+				fail(configPath, fmt.Errorf("no profile named %q", profile))
+			}
+			combined = append(combined, profileArguments...)
+		}
+	} else if profile != "" {
+		fail("--profile", fmt.Errorf("profiles come from the configuration file, which --no-config skips"))
+	}
+	return append(combined, environment...)
+}
+
+// selection returns whether --no-config is among the arguments and the
+// profile the last --profile=NAME selects. Since --profile is handled
+// before the options are parsed, it is checked here: it needs a name
+// given with "=", like every option taking a value.
+func selection(arguments []string) (bool, string, error) {
+	noConfig, profile := false, ""
+	for _, argument := range arguments {
+		switch {
+		case argument == "--no-config":
+			noConfig = true
+		case argument == "--profile" || argument == "--profile=":
+			return false, "", fmt.Errorf("a profile name is needed (--profile=NAME)")
+		case strings.HasPrefix(argument, "--profile="):
+			profile = strings.TrimPrefix(argument, "--profile=")
+		}
+	}
+	return noConfig, profile, nil
+}
+
+// optionArguments returns the arguments before "--".
+func optionArguments(arguments []string) []string {
+	for index, argument := range arguments {
+		if argument == "--" {
+			return arguments[:index]
+		}
+	}
+	return arguments
+}
+
+// checkOptionsOnly rejects words that are not options, since paths in
+// MYLS_OPTIONS would be listed by every run, and the options only taken
+// on the command line.
+func checkOptionsOnly(words []string) error {
+	for _, word := range words {
+		if !strings.HasPrefix(word, "-") || word == "-" || word == "--" {
+			return fmt.Errorf("only options are allowed, not %q", word)
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(word, "--"), "=")
+		if strings.HasPrefix(word, "--") && commandLineOnly(name) {
+			return fmt.Errorf("option %q is only taken on the command line", name)
+		}
+	}
+	return nil
+}
+
+// commandLineOnly reports whether the option with the given long name is
+// refused in the configuration file and MYLS_OPTIONS: --trust-dirconfig,
+// so that trusting the .mylsrc files of a directory is always asked for
+// by the run listing it, never made permanent.
+func commandLineOnly(name string) bool {
+	return name == "trust-dirconfig" || name == "no-trust-dirconfig"
+}
+
+// fail reports a configuration problem and ends the run.
+func fail(source string, err error) {
+	status.Report(status.Serious, "", source, err.Error())
+	os.Exit(status.ExitCode())
+}
+
+// Load reads and parses the configuration file at configPath. A missing
+// file is an empty configuration.
+func Load(configPath string) (File, error) {
+	configFile := File{Profiles: make(map[string][]string)}
+	if configPath == "" {
+		return configFile, nil
+	}
+	content, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return configFile, nil
+	}
+	if err != nil {
+		return configFile, fmt.Errorf("%s", status.Describe(err))
+	}
+	return configFile, Parse(string(content), &configFile)
+}
+
+// Parse reads the TOML subset of the configuration file into configFile:
+// "key = value" lines, whose keys are long option names, before any table
+// for the defaults and under [profile.NAME] tables for the profiles.
+// Values are strings, integers, booleans (true for --key, false for
+// --no-key) and arrays, which give the option once per element.
+func Parse(content string, configFile *File) error {
+	profile := "" // The [profile.NAME] table being read, "" before any.
+	lines := strings.Split(content, "\n")
+	for index := 0; index < len(lines); index++ {
+		lineNumber := index + 1
+		line := strings.TrimSpace(stripComment(lines[index]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			table := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			name, ok := strings.CutPrefix(table, "profile.")
+			if !ok || !strings.HasSuffix(line, "]") || name == "" {
+				return fmt.Errorf("line %d: unknown table %s (use [profile.NAME])", lineNumber, line)
+			}
+			profile = unquote(name)
+			configFile.Profiles[profile] = configFile.Profiles[profile]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+		key, value = unquote(strings.TrimSpace(key)), strings.TrimSpace(value)
+		// An array may continue on the following lines up to its closing bracket.
+		for strings.HasPrefix(value, "[") && !arrayClosed(value) && index+1 < len(lines) {
+			index++
+			value += " " + strings.TrimSpace(stripComment(lines[index]))
+		}
+
+		optionArguments, err := optionsFor(key, value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if profile == "" {
+			configFile.Defaults = append(configFile.Defaults, optionArguments...)
+		} else {
+			configFile.Profiles[profile] = append(configFile.Profiles[profile], optionArguments...)
+		}
+	}
+	return nil
+}
+
+// optionsFor converts one "key = value" setting into command line arguments.
+func optionsFor(key string, value string) ([]string, error) {
+	option := flags.Lookup(key)
+	if option == nil || key == "help" || key == "man" || key == "profile" || key == "no-config" || key == "completion" {
+		return nil, fmt.Errorf("unknown option %q", key)
+	}
+	if commandLineOnly(key) {
+		return nil, fmt.Errorf("option %q is only taken on the command line", key)
+	}
+
+	switch {
+	case value == "true" || value == "false":
+		if option.Value != "" && !option.Optional {
+			return nil, fmt.Errorf("option %q needs a value, not %s", key, value)
+		}
+		if value == "true" {
+			return []string{"--" + key}, nil
+		}
+		if !option.Negatable() {
+			return nil, fmt.Errorf("option %q cannot be turned off", key)
+		}
+		return []string{"--no-" + key}, nil
+	case strings.HasPrefix(value, "["):
+		elements, err := parseArray(value)
+		if err != nil {
+			return nil, err
+		}
+		var arguments []string
+		for _, element := range elements {
+			arguments = append(arguments, "--"+key+"="+element)
+		}
+		if option.Value == "" && len(arguments) > 0 {
+			return nil, fmt.Errorf("option %q takes no value (use true or false)", key)
+		}
+		return arguments, nil
+	}
+
+	scalar, err := parseScalar(value)
+	if err != nil {
+		return nil, err
+	}
+	if option.Value == "" {
+		return nil, fmt.Errorf("option %q takes no value (use true or false)", key)
+	}
+	return []string{"--" + key + "=" + scalar}, nil
+}
+
+// parseScalar returns the text of a string or integer value.
+func parseScalar(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return unquoted, nil
+	}
+	if strings.HasPrefix(value, "'") {
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid value %s (quote strings)", value)
+	}
+	return value, nil
+}
+
+// parseArray returns the elements of a one-level array of scalars.
+func parseArray(value string) ([]string, error) {
+	inner := strings.TrimSpace(value[1:])
+	if !strings.HasSuffix(inner, "]") {
+		return nil, fmt.Errorf("unterminated array %s", value)
+	}
+	inner = strings.TrimSpace(strings.TrimSuffix(inner, "]"))
+
+	var elements []string
+	for inner != "" {
+		end := elementEnd(inner)
+		element, err := parseScalar(strings.TrimSpace(inner[:end]))
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		inner = strings.TrimSpace(strings.TrimPrefix(inner[end:], ","))
+	}
+	return elements, nil
+}
+
+// elementEnd returns the index of the comma ending the first array
+// element of s, or len(s).
+func elementEnd(s string) int {
+	var quote rune
+	escaped := false
+	for index, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			return index
+		}
+	}
+	return len(s)
+}
+
+// arrayClosed reports whether value holds the closing bracket of its array.
+func arrayClosed(value string) bool {
+	return strings.HasSuffix(strings.TrimSpace(value), "]")
+}
+
+// stripComment removes a "#" comment that is not inside a string.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for index, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:index]
+		}
+	}
+	return line
+}
+
+// unquote removes the quotes of a quoted key or table name.
+func unquote(name string) string {
+	if len(name) >= 2 && (name[0] == '"' || name[0] == '\'') && name[len(name)-1] == name[0] {
+		return name[1 : len(name)-1]
+	}
+	return name
+}
+
+// SplitWords splits s into words the way a shell does for simple cases:
+// at white space, except inside single or double quotes, and with a
+// backslash escaping the next character outside single quotes.
+func SplitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
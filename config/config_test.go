@@ -0,0 +1,286 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"eles/flags"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		defaults []string
+		profiles map[string][]string
+	}{
+		{
+			name:     "double quoted string",
+			content:  `sort = "size"`,
+			defaults: []string{"--sort=size"},
+		},
+		{
+			name:     "single quoted string",
+			content:  `hide = '*.o'`,
+			defaults: []string{"--hide=*.o"},
+		},
+		{
+			name:     "quoted key",
+			content:  `"max-depth" = 2`,
+			defaults: []string{"--max-depth=2"},
+		},
+		{
+			name:     "escapes in a double quoted string",
+			content:  `hide = "tab\there \"quoted\" back\\slash \u00e9"`,
+			defaults: []string{"--hide=tab\there \"quoted\" back\\slash é"},
+		},
+		{
+			name:     "no escapes in a single quoted string",
+			content:  `hide = 'C:\temp\n'`,
+			defaults: []string{`--hide=C:\temp\n`},
+		},
+		{
+			name:     "array",
+			content:  `hide = ["*.o", '*.tmp']`,
+			defaults: []string{"--hide=*.o", "--hide=*.tmp"},
+		},
+		{
+			name:     "empty array",
+			content:  `hide = []`,
+			defaults: nil,
+		},
+		{
+			name: "multi-line array with comments and a trailing comma",
+			content: `hide = [
+	"*.o",   # objects
+	'*.tmp', # editor files
+]
+reverse = true`,
+			defaults: []string{"--hide=*.o", "--hide=*.tmp", "--reverse"},
+		},
+		{
+			name:     "comment after a value",
+			content:  `sort = "time" # newest first`,
+			defaults: []string{"--sort=time"},
+		},
+		{
+			name:     "comment character inside strings",
+			content:  "hide = [\"#build\", 'b#', \"a\\\"#b\"] # the comment",
+			defaults: []string{"--hide=#build", "--hide=b#", `--hide=a"#b`},
+		},
+		{
+			name:     "comment lines and blank lines",
+			content:  "# myls configuration\n\n  # indented\nall = true\n",
+			defaults: []string{"--all"},
+		},
+		{
+			name:     "true and false",
+			content:  "all = true\nreverse = false",
+			defaults: []string{"--all", "--no-reverse"},
+		},
+		{
+			name:     "true for an optional value",
+			content:  "count = true",
+			defaults: []string{"--count"},
+		},
+		{
+			name:     "false for an optional value",
+			content:  "count = false",
+			defaults: []string{"--no-count"},
+		},
+		{
+			name: "profiles",
+			content: `reverse = true
+
+[profile.big]
+sort = "size"
+count = "recursive"
+
+[profile."old files"]
+sort = "time"
+reverse = false
+`,
+			defaults: []string{"--reverse"},
+			profiles: map[string][]string{
+				"big":       {"--sort=size", "--count=recursive"},
+				"old files": {"--sort=time", "--no-reverse"},
+			},
+		},
+		{
+			name:     "empty profile",
+			content:  "[profile.plain]",
+			profiles: map[string][]string{"plain": nil},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configFile := File{Profiles: make(map[string][]string)}
+			if err := Parse(test.content, &configFile); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !slices.Equal(configFile.Defaults, test.defaults) {
+				t.Errorf("defaults = %q, want %q", configFile.Defaults, test.defaults)
+			}
+			if len(configFile.Profiles) != len(test.profiles) {
+				t.Errorf("profiles = %q, want %q", configFile.Profiles, test.profiles)
+			}
+			for name, arguments := range test.profiles {
+				got, ok := configFile.Profiles[name]
+				if !ok || !slices.Equal(got, arguments) {
+					t.Errorf("profile %q = %q, want %q", name, got, arguments)
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // Expected in the error.
+	}{
+		{"unknown table", "[colors]\nall = true", `line 1: unknown table [colors]`},
+		{"profile without a name", "[profile.]", "unknown table"},
+		{"unclosed table", "[profile.big", "unknown table"},
+		{"unknown key", "all = true\nshiny = true", `line 2: unknown option "shiny"`},
+		{"help", "help = true", `unknown option "help"`},
+		{"man", "man = true", `unknown option "man"`},
+		{"profile", `profile = "big"`, `unknown option "profile"`},
+		{"no-config", "no-config = true", `unknown option "no-config"`},
+		{"completion", `completion = "bash"`, `unknown option "completion"`},
+		{"trust-dirconfig", "trust-dirconfig = true", `option "trust-dirconfig" is only taken on the command line`},
+		{"trust-dirconfig in a profile", "[profile.p]\ntrust-dirconfig = false", `line 2: option "trust-dirconfig" is only taken on the command line`},
+		{"missing equals sign", "all", "line 1: expected key = value"},
+		{"unquoted string", "sort = size", "quote strings"},
+		{"unterminated string", `sort = "size`, "invalid string"},
+		{"unterminated array", `hide = ["*.o"`, "unterminated array"},
+		{"string for a switch", `all = "yes"`, `option "all" takes no value`},
+		{"array for a switch", `all = ["yes"]`, `option "all" takes no value`},
+		{"true for a required value", "sort = true", `option "sort" needs a value`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configFile := File{Profiles: make(map[string][]string)}
+			err := Parse(test.content, &configFile)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Parse(%q) = %v, want an error containing %q", test.content, err, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"  -l\t-a  ", []string{"-l", "-a"}},
+		{`--hide='*.o' --hide="a b"`, []string{"--hide=*.o", "--hide=a b"}},
+		{`--hide=a\ b`, []string{"--hide=a b"}},
+		{`--hide='a\b'`, []string{`--hide=a\b`}},
+		{`--hide="say \"hi\""`, []string{`--hide=say "hi"`}},
+		{`--hide=""`, []string{"--hide="}},
+	}
+	for _, test := range tests {
+		got, err := SplitWords(test.s)
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("SplitWords(%q) = %q, %v, want %q", test.s, got, err, test.want)
+		}
+	}
+	for _, s := range []string{`--hide='*.o`, `--hide="a`, `-l \`} {
+		if _, err := SplitWords(s); err == nil {
+			t.Errorf("SplitWords(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestCheckOptionsOnly(t *testing.T) {
+	if err := checkOptionsOnly([]string{"-l", "--sort=size", "--no-color"}); err != nil {
+		t.Errorf("checkOptionsOnly of options: %v", err)
+	}
+	for _, words := range [][]string{
+		{"-l", "/tmp"},
+		{"-"},
+		{"--"},
+		{"--trust-dirconfig"},
+		{"--no-trust-dirconfig"},
+	} {
+		if err := checkOptionsOnly(words); err == nil {
+			t.Errorf("checkOptionsOnly(%q) succeeded, want an error", words)
+		}
+	}
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		noConfig  bool
+		profile   string
+		fails     bool
+	}{
+		{nil, false, "", false},
+		{[]string{"-l", "--profile=big"}, false, "big", false},
+		{[]string{"--profile=big", "--profile=small"}, false, "small", false},
+		{[]string{"--no-config", "-a"}, true, "", false},
+		{[]string{"--profile", "big"}, false, "", true},
+		{[]string{"--profile="}, false, "", true},
+		{[]string{"--profile=big", "--profile"}, false, "", true},
+	}
+	for _, test := range tests {
+		noConfig, profile, err := selection(test.arguments)
+		if (err != nil) != test.fails {
+			t.Errorf("selection(%q) error = %v, want failure %v", test.arguments, err, test.fails)
+			continue
+		}
+		if noConfig != test.noConfig || profile != test.profile {
+			t.Errorf("selection(%q) = %v, %q, want %v, %q", test.arguments, noConfig, profile, test.noConfig, test.profile)
+		}
+	}
+}
+
+// TestPrecedence checks that each source of options overrides the ones
+// before it: built-in < config < profile < MYLS_OPTIONS < command line.
+func TestPrecedence(t *testing.T) {
+	configHome := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(configHome, "myls"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := "max-depth = 1\nhide = \"config\"\n\n[profile.deep]\nmax-depth = 2\nhide = \"profile\"\n"
+	if err := os.WriteFile(filepath.Join(configHome, "myls", "config.toml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	tests := []struct {
+		name        string
+		environment string
+		arguments   []string
+		maxDepth    int
+		hide        []string
+	}{
+		{"built-in", "", []string{"--no-config"}, -1, nil},
+		{"config", "", nil, 1, []string{"config"}},
+		{"profile", "", []string{"--profile=deep"}, 2, []string{"config", "profile"}},
+		{"environment", "--max-depth=3 --hide=environment", []string{"--profile=deep"}, 3, []string{"config", "profile", "environment"}},
+		{"command line", "--max-depth=3", []string{"--profile=deep", "--max-depth=4", "--hide=argv"}, 4, []string{"config", "profile", "argv"}},
+		{"environment without config", "--max-depth=3", []string{"--no-config"}, 3, nil},
+		{"negation on the command line", "--hide=environment", []string{"--no-hide"}, 1, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(EnvironmentVariable, test.environment)
+			options := flags.ParseArgs(Defaults(test.arguments), test.arguments)
+			if options.MaxDepth != test.maxDepth {
+				t.Errorf("MaxDepth = %d, want %d", options.MaxDepth, test.maxDepth)
+			}
+			if !slices.Equal(options.Hide, test.hide) {
+				t.Errorf("Hide = %q, want %q", options.Hide, test.hide)
+			}
+		})
+	}
+}
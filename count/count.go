@@ -0,0 +1,93 @@
+package count
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"eles/filter"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+	"eles/walk"
+)
+
+// countedEntry is a directory entry annotated with the number of entries
+// the directory holds (--count).
+type countedEntry struct {
+	fs.DirEntry
+	children string
+}
+
+// ChildCount returns the formatted count shown in the long format column.
+func (c *countedEntry) ChildCount() string {
+	return c.children
+}
+
+// Annotate wraps every directory among dirEntries (except "..") with the
+// number of entries it holds: its immediate children, or with
+// --count=recursive the files and directories of its whole tree ("12f/3d").
+// The same -a, --ignore and --hide rules as the listing decide what counts.
+// Directories are counted concurrently by the idle workers of the listing
+// (see utils.Workers), and unreadable subtrees are reported to diagnostics.
+func Annotate(dirEntries []fs.DirEntry, directoryPath string, options flags.Options, workers utils.Workers, diagnostics *status.Queue) []fs.DirEntry {
+	var group sync.WaitGroup
+
+	for index, entry := range dirEntries {
+		if entry.Name() == ".." {
+			continue
+		}
+		entryInfo, err := entry.Info()
+		if err != nil || !entryInfo.IsDir() {
+			continue
+		}
+		entryPath := entry.Name()
+		if !filepath.IsAbs(entryPath) {
+			entryPath = filepath.Join(directoryPath, entryPath)
+		}
+
+		workers.Go(&group, func() {
+			var children string
+			if options.Count == "recursive" {
+				children = countTree(entryPath, options, diagnostics)
+			} else {
+				children = countChildren(entryPath, options)
+			}
+			dirEntries[index] = &countedEntry{DirEntry: dirEntries[index], children: children}
+		})
+	}
+	group.Wait()
+	return dirEntries
+}
+
+// countChildren returns the number of listed entries directly inside a directory.
+func countChildren(directoryPath string, options flags.Options) string {
+	dirEntries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		return "?"
+	}
+	children := 0
+	for _, entry := range filter.Apply(dirEntries, options, directoryPath) {
+		if entry.Name() != "." && entry.Name() != ".." {
+			children++
+		}
+	}
+	return fmt.Sprintf("%d", children)
+}
+
+// countTree returns the number of files and directories below a directory.
+func countTree(directoryPath string, options flags.Options, diagnostics *status.Queue) string {
+	treeOptions := options
+	treeOptions.MaxDepth = -1
+	files, directories := 0, 0
+	walk.WalkQueued(directoryPath, treeOptions, diagnostics, func(entryPath string, entryInfo os.FileInfo, depth int) {
+		if entryInfo.IsDir() {
+			directories++
+		} else {
+			files++
+		}
+	})
+	return fmt.Sprintf("%df/%dd", files, directories)
+}
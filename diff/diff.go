@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+	"eles/walk"
+)
+
+// The colors of the markers and paths of added, removed and changed entries.
+const (
+	removedColor = "\033[31m"
+	addedColor   = "\033[32m"
+	changedColor = "\033[33m"
+	resetColor   = "\033[0m"
+)
+
+// Run compares the trees of the two paths of options (myls diff LEFT
+// RIGHT), walked with the rules of a recursive listing, and prints one line
+// per difference, by relative path: "- path" for an entry only in LEFT,
+// "+ path" for one only in RIGHT and "~ path: ..." with what changed for
+// one in both. The contents of a directory found on one side only, or
+// replaced by another type of file, are not listed. A summary follows.
+// As with diff(1), the exit status is 1 when the trees differ and 2 when
+// any problem was reported.
+func Run(options flags.Options, outputWriter io.Writer) {
+	leftPath, rightPath := options.Paths[0], options.Paths[1]
+	for _, rootPath := range options.Paths {
+		rootInfo, err := os.Stat(rootPath)
+		if err != nil {
+			status.ReportError(status.Serious, "cannot access", rootPath, err)
+			return
+		}
+		if !rootInfo.IsDir() {
+			status.Report(status.Serious, "", rootPath, "not a directory")
+			return
+		}
+	}
+	left, right := collect(leftPath, options), collect(rightPath, options)
+
+	var relativePaths []string
+	for relativePath := range left {
+		relativePaths = append(relativePaths, relativePath)
+	}
+	for relativePath := range right {
+		if _, ok := left[relativePath]; !ok {
+			relativePaths = append(relativePaths, relativePath)
+		}
+	}
+	// Sorted by component, so every directory comes right before its contents.
+	slices.SortFunc(relativePaths, func(a string, b string) int {
+		return slices.Compare(strings.Split(a, string(filepath.Separator)), strings.Split(b, string(filepath.Separator)))
+	})
+
+	added, removed, changed := 0, 0, 0
+	// summarized holds the entries whose contents are not compared: found on
+	// one side only, or of another type on each side.
+	summarized := make(map[string]bool)
+	for _, relativePath := range relativePaths {
+		if summarized[filepath.Dir(relativePath)] {
+			summarized[relativePath] = true
+			continue
+		}
+		leftInfo, inLeft := left[relativePath]
+		rightInfo, inRight := right[relativePath]
+		switch {
+		case !inRight:
+			removed++
+			summarized[relativePath] = true
+			printLine(outputWriter, "-", relativePath, "", removedColor, options)
+		case !inLeft:
+			added++
+			summarized[relativePath] = true
+			printLine(outputWriter, "+", relativePath, "", addedColor, options)
+		default:
+			changes := compare(filepath.Join(leftPath, relativePath), leftInfo, filepath.Join(rightPath, relativePath), rightInfo, options)
+			if len(changes) == 0 {
+				continue
+			}
+			changed++
+			if leftInfo.Mode().Type() != rightInfo.Mode().Type() {
+				summarized[relativePath] = true
+			}
+			printLine(outputWriter, "~", relativePath, ": "+strings.Join(changes, ", "), changedColor, options)
+		}
+	}
+
+	switch {
+	case status.ExitCode() != 0:
+		status.Raise(status.Serious)
+	case added+removed+changed > 0:
+		status.Raise(status.Minor)
+	}
+	if added+removed+changed == 0 {
+		fmt.Fprintf(outputWriter, "%s and %s are the same\n", leftPath, rightPath)
+		return
+	}
+	fmt.Fprintf(outputWriter, "\n%d added, %d removed, %d changed\n", added, removed, changed)
+}
+
+// collect returns the lstat information of everything below rootPath, by
+// path relative to it.
+func collect(rootPath string, options flags.Options) map[string]os.FileInfo {
+	entries := make(map[string]os.FileInfo)
+	walk.Walk(rootPath, options, func(entryPath string, entryInfo os.FileInfo, depth int) {
+		if relativePath, err := filepath.Rel(rootPath, entryPath); err == nil {
+			entries[relativePath] = entryInfo
+		}
+	})
+	return entries
+}
+
+// compare returns what differs between the entry at leftPath and the one
+// at rightPath, e.g. "size 10 -> 12", or nothing when they are the same.
+// The size and times of directories are not compared: they follow from
+// their contents.
+func compare(leftPath string, leftInfo os.FileInfo, rightPath string, rightInfo os.FileInfo, options flags.Options) []string {
+	leftType, rightType := utils.FileTypeName(leftInfo.Mode()), utils.FileTypeName(rightInfo.Mode())
+	if leftType != rightType {
+		return []string{"type " + leftType + " -> " + rightType}
+	}
+
+	var changes []string
+	regular := leftInfo.Mode().IsRegular()
+	if regular && leftInfo.Size() != rightInfo.Size() {
+		changes = append(changes, fmt.Sprintf("size %d -> %d", leftInfo.Size(), rightInfo.Size()))
+	}
+	if leftMode, rightMode := utils.GetPermissions(leftInfo), utils.GetPermissions(rightInfo); leftMode != rightMode {
+		changes = append(changes, "mode "+leftMode+" -> "+rightMode)
+	}
+	if leftInfo.Mode()&os.ModeSymlink != 0 {
+		leftTarget, _ := os.Readlink(leftPath)
+		rightTarget, _ := os.Readlink(rightPath)
+		if leftTarget != rightTarget {
+			changes = append(changes, "target "+leftTarget+" -> "+rightTarget)
+		}
+	}
+	if options.Times && !leftInfo.IsDir() && !leftInfo.ModTime().Equal(rightInfo.ModTime()) {
+		changes = append(changes, "modified "+leftInfo.ModTime().Format("2006-01-02 15:04:05")+" -> "+rightInfo.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	if options.Content && regular && leftInfo.Size() == rightInfo.Size() && !sameContent(leftPath, rightPath) {
+		changes = append(changes, "content")
+	}
+	return changes
+}
+
+// sameContent reports whether two files of the same size hold the same
+// bytes. Files that cannot be read are reported and taken as the same.
+func sameContent(leftPath string, rightPath string) bool {
+	leftFile, err := os.Open(leftPath)
+	if err != nil {
+		status.ReportError(status.Minor, "cannot open", leftPath, err)
+		return true
+	}
+	defer leftFile.Close()
+	rightFile, err := os.Open(rightPath)
+	if err != nil {
+		status.ReportError(status.Minor, "cannot open", rightPath, err)
+		return true
+	}
+	defer rightFile.Close()
+
+	leftBuffer, rightBuffer := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		leftCount, leftErr := io.ReadFull(leftFile, leftBuffer)
+		rightCount, rightErr := io.ReadFull(rightFile, rightBuffer)
+		if !bytes.Equal(leftBuffer[:leftCount], rightBuffer[:rightCount]) {
+			return false
+		}
+		leftEnd := leftErr == io.EOF || leftErr == io.ErrUnexpectedEOF
+		rightEnd := rightErr == io.EOF || rightErr == io.ErrUnexpectedEOF
+		switch {
+		case leftErr != nil && !leftEnd:
+			status.ReportError(status.Minor, "cannot read", leftPath, leftErr)
+			return true
+		case rightErr != nil && !rightEnd:
+			status.ReportError(status.Minor, "cannot read", rightPath, rightErr)
+			return true
+		case leftEnd || rightEnd:
+			return leftEnd == rightEnd
+		}
+	}
+}
+
+// printLine prints the line of one difference, its marker and path colored
+// unless the output is colorless.
+func printLine(outputWriter io.Writer, marker string, relativePath string, changes string, color string, options flags.Options) {
+	if options.Colorless() {
+		fmt.Fprintf(outputWriter, "%s %s%s\n", marker, relativePath, changes)
+		return
+	}
+	fmt.Fprintf(outputWriter, "%s%s %s%s%s\n", color, marker, relativePath, resetColor, changes)
+}
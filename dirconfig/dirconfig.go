@@ -0,0 +1,242 @@
+package dirconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"eles/config"
+	"eles/flags"
+	"eles/status"
+)
+
+// FileName is the file holding the listing preferences of a directory.
+const FileName = ".mylsrc"
+
+// settable lists the options a .mylsrc may set; everything else is about
+// the run rather than the directory and stays with the user.
+var settable = []string{"sort", "hide", "columns"}
+
+var (
+	mutex sync.Mutex
+	// loaded holds the arguments of every .mylsrc read so far, by absolute
+	// path; nil for a missing, untrusted or invalid file, which is reported
+	// only the first time.
+	loaded = make(map[string][]string)
+	// trusted maps the absolute path of each trusted .mylsrc to the SHA-256
+	// of its content, read from config.TrustPath on first use.
+	trusted map[string]string
+)
+
+// Apply returns options with the preferences of the .mylsrc files that
+// apply to directoryPath: its own and, with --dirconfig=ancestors, those of
+// its ancestors, the nearest one last so it wins. A .mylsrc is only read
+// once it is trusted (--trust-dirconfig records it with a hash of its
+// content); an untrusted or changed one is reported and ignored. Options
+// given on the command line are left alone.
+func Apply(directoryPath string, options flags.Options) flags.Options {
+	return ApplyQueued(directoryPath, options, nil)
+}
+
+// ApplyQueued is Apply with the problems of the .mylsrc files held in
+// diagnostics, for a directory read ahead of its listing.
+func ApplyQueued(directoryPath string, options flags.Options, diagnostics *status.Queue) flags.Options {
+	if options.DirConfig == "" {
+		return options
+	}
+	for _, rcPath := range candidates(directoryPath, options.DirConfig == "ancestors") {
+		for _, argument := range load(rcPath, options.TrustDirConfig, diagnostics) {
+			options = applyArgument(options, argument)
+		}
+	}
+	return options
+}
+
+// candidates returns the .mylsrc paths that may apply to directoryPath,
+// farthest first: with ancestors, those of the directories above it up to
+// the root, then its own.
+func candidates(directoryPath string, ancestors bool) []string {
+	rcPaths := []string{filepath.Join(directoryPath, FileName)}
+	if !ancestors {
+		return rcPaths
+	}
+	absolutePath, err := filepath.Abs(directoryPath)
+	if err != nil {
+		return rcPaths
+	}
+	for parent := filepath.Dir(absolutePath); ; parent = filepath.Dir(parent) {
+		rcPaths = append([]string{filepath.Join(parent, FileName)}, rcPaths...)
+		if parent == filepath.Dir(parent) {
+			return rcPaths
+		}
+	}
+}
+
+// load returns the option arguments of the .mylsrc at rcPath, or nil when
+// there is none or it cannot be used. With trust the file is trusted first.
+// Problems are reported to diagnostics.
+func load(rcPath string, trust bool, diagnostics *status.Queue) []string {
+	absolutePath, err := filepath.Abs(rcPath)
+	if err != nil {
+		return nil
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if arguments, ok := loaded[absolutePath]; ok {
+		return arguments
+	}
+	loaded[absolutePath] = nil
+
+	content, err := os.ReadFile(absolutePath)
+	if err != nil {
+		if !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) {
+			diagnostics.ReportError(status.Warning, "cannot read", rcPath, err)
+		}
+		return nil
+	}
+
+	if !isTrusted(absolutePath, content) {
+		if !trust {
+			reason := "not trusted, ignored (list it with --trust-dirconfig to trust it)"
+			if _, ok := trusted[absolutePath]; ok {
+				reason = "changed since it was trusted, ignored (list it with --trust-dirconfig to trust it again)"
+			}
+			diagnostics.Report(status.Warning, "", rcPath, reason)
+			return nil
+		}
+		recordTrust(absolutePath, content, diagnostics)
+	}
+
+	rcFile := config.File{Profiles: make(map[string][]string)}
+	err = config.Parse(string(content), &rcFile)
+	if err == nil && len(rcFile.Profiles) > 0 {
+		err = fmt.Errorf("profiles belong in the configuration file")
+	}
+	if err == nil {
+		err = check(rcFile.Defaults)
+	}
+	if err != nil {
+		diagnostics.Report(status.Minor, "", rcPath, err.Error())
+		return nil
+	}
+	loaded[absolutePath] = rcFile.Defaults
+	return rcFile.Defaults
+}
+
+// check rejects the options a .mylsrc may not set and invalid values.
+func check(arguments []string) error {
+	for _, argument := range arguments {
+		name, value, _ := strings.Cut(strings.TrimPrefix(argument, "--"), "=")
+		switch name {
+		case "sort":
+			if choices := flags.Lookup("sort").Choices; !slices.Contains(choices, value) {
+				return fmt.Errorf("invalid sort %q (use %s)", value, strings.Join(choices, ", "))
+			}
+		case "columns":
+			if _, err := flags.ParseColumns(value); err != nil {
+				return err
+			}
+		case "hide", "no-hide", "no-columns":
+		default:
+			return fmt.Errorf("option %q cannot be set in %s (use %s)", strings.TrimPrefix(name, "no-"), FileName, strings.Join(settable, ", "))
+		}
+	}
+	return nil
+}
+
+// applyArgument applies one option of a .mylsrc, unless the command line
+// gave that option itself.
+func applyArgument(options flags.Options, argument string) flags.Options {
+	name, value, _ := strings.Cut(strings.TrimPrefix(argument, "--"), "=")
+	given := options.CommandLine
+	switch name {
+	case "sort":
+		if !given["sort"] && !given["t"] && !given["S"] && !given["U"] && !given["v"] {
+			options.SetSort(value)
+		}
+	case "hide":
+		if !given["no-hide"] {
+			options.Hide = append(slices.Clip(options.Hide), value)
+		}
+	case "no-hide":
+		if !given["hide"] {
+			options.Hide = nil
+		}
+	case "columns":
+		if !given["columns"] && !given["no-columns"] {
+			options.Columns, _ = flags.ParseColumns(value)
+		}
+	case "no-columns":
+		if !given["columns"] && !given["no-columns"] {
+			options.Columns = nil
+		}
+	}
+	return options
+}
+
+// isTrusted reports whether the .mylsrc at absolutePath was trusted with
+// this content. The caller holds mutex.
+func isTrusted(absolutePath string, content []byte) bool {
+	if trusted == nil {
+		trusted = readTrusted(config.TrustPath())
+	}
+	return trusted[absolutePath] == hash(content)
+}
+
+// readTrusted reads the trust file: one "SHA-256 path" line per file.
+func readTrusted(trustPath string) map[string]string {
+	trustedFiles := make(map[string]string)
+	content, err := os.ReadFile(trustPath)
+	if err != nil {
+		return trustedFiles
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		sum, trustedPath, ok := strings.Cut(line, " ")
+		if ok {
+			trustedFiles[trustedPath] = sum
+		}
+	}
+	return trustedFiles
+}
+
+// recordTrust trusts the .mylsrc at absolutePath with this content and
+// rewrites the trust file. The caller holds mutex.
+func recordTrust(absolutePath string, content []byte, diagnostics *status.Queue) {
+	trusted[absolutePath] = hash(content)
+	trustPath := config.TrustPath()
+	if trustPath == "" {
+		return
+	}
+
+	var trustedPaths []string
+	for trustedPath := range trusted {
+		trustedPaths = append(trustedPaths, trustedPath)
+	}
+	sort.Strings(trustedPaths)
+	var lines strings.Builder
+	for _, trustedPath := range trustedPaths {
+		fmt.Fprintf(&lines, "%s %s\n", trusted[trustedPath], trustedPath)
+	}
+
+	err := os.MkdirAll(filepath.Dir(trustPath), 0755)
+	if err == nil {
+		err = os.WriteFile(trustPath, []byte(lines.String()), 0644)
+	}
+	if err != nil {
+		diagnostics.ReportError(status.Minor, "cannot write", trustPath, err)
+	}
+}
+
+// hash returns the hexadecimal SHA-256 of content.
+func hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,75 @@
+package display
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"eles/width"
+)
+
+// columnGap is the number of spaces between two columns of names.
+const columnGap = 2
+
+// printColumns prints names down then across in as many columns as fit in
+// lineWidth terminal cells, each column as wide as its widest name, as GNU
+// ls does on a terminal. With a lineWidth of 0 the names are printed on a
+// single line.
+func printColumns(names []string, lineWidth int, outputWriter io.Writer) {
+	if len(names) == 0 {
+		return
+	}
+	if lineWidth <= 0 {
+		fmt.Fprintln(outputWriter, strings.Join(names, strings.Repeat(" ", columnGap)))
+		return
+	}
+	nameWidths := make([]int, len(names))
+	for index, name := range names {
+		nameWidths[index] = width.StringWidth(name)
+	}
+	rows, columnWidths := columnLayout(nameWidths, lineWidth)
+	var line strings.Builder
+	for row := 0; row < rows; row++ {
+		line.Reset()
+		for column, columnWidth := range columnWidths {
+			index := column*rows + row
+			if index >= len(names) {
+				break
+			}
+			if index+rows < len(names) {
+				line.WriteString(width.PadRight(names[index], columnWidth+columnGap))
+			} else {
+				line.WriteString(names[index])
+			}
+		}
+		fmt.Fprintln(outputWriter, line.String())
+	}
+}
+
+// columnLayout returns the number of rows and the column widths of the
+// layout with the most columns whose lines stay narrower than lineWidth,
+// leaving the last cell free so that terminals do not wrap. Names too wide
+// for any layout are given a column of their own.
+func columnLayout(nameWidths []int, lineWidth int) (int, []int) {
+	// A column takes at least one cell and the gap after it.
+	maxColumns := min(len(nameWidths), max(1, lineWidth/(1+columnGap)))
+	for columns := maxColumns; columns > 1; columns-- {
+		rows := (len(nameWidths) + columns - 1) / columns
+		if (columns-1)*rows >= len(nameWidths) {
+			// The last column would be empty; fewer columns give the same rows.
+			continue
+		}
+		columnWidths := make([]int, columns)
+		for index, nameWidth := range nameWidths {
+			columnWidths[index/rows] = max(columnWidths[index/rows], nameWidth)
+		}
+		lineLength := (columns - 1) * columnGap
+		for _, columnWidth := range columnWidths {
+			lineLength += columnWidth
+		}
+		if lineLength < lineWidth {
+			return rows, columnWidths
+		}
+	}
+	return len(nameWidths), []int{0}
+}
@@ -0,0 +1,36 @@
+package display
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintColumns(t *testing.T) {
+	tests := []struct {
+		name      string
+		names     []string
+		lineWidth int
+		want      string
+	}{
+		{"not a terminal", []string{"a", "bb", "c"}, 0, "a  bb  c\n"},
+		{"one line", []string{"a", "bb", "c"}, 80, "a  bb  c\n"},
+		{"down then across", []string{"one", "two", "three", "four", "five"}, 20, "one  three  five\ntwo  four\n"},
+		{"fewer columns when narrower", []string{"one", "two", "three", "four", "five"}, 16, "one    four\ntwo    five\nthree\n"},
+		{"fewer names in the last column", []string{"a", "b", "c", "d", "e"}, 9, "a  c  e\nb  d\n"},
+		{"one cell to spare", []string{"abcd", "efgh"}, 11, "abcd  efgh\n"},
+		{"the last cell stays free", []string{"abcd", "efgh"}, 10, "abcd\nefgh\n"},
+		{"a name wider than the line", []string{"a", "toolongname", "b"}, 5, "a\ntoolongname\nb\n"},
+		{"wide characters", []string{"日本語", "ab", "한국", "🎉"}, 13, "日本語  한국\nab      🎉\n"},
+		{"colors take no cells", []string{"\033[01;34mdir\033[0m", "ab", "cd", "ef"}, 10, "\033[01;34mdir\033[0m  cd\nab   ef\n"},
+		{"no names", nil, 80, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			printColumns(test.names, test.lineWidth, &output)
+			if got := output.String(); got != test.want {
+				t.Errorf("printColumns(%q, %d) =\n%q\nwant\n%q", test.names, test.lineWidth, got, test.want)
+			}
+		})
+	}
+}
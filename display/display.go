@@ -6,50 +6,107 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"eles/colorize"
+	"eles/output"
+	"eles/status"
 	"eles/utils"
+	"eles/width"
 )
 
 // DisplayFiles prints file names either in long format (if "-l" flag is set)
-// or in a compact single-line format.
+// or in columns fitted to the terminal width (see printColumns).
 func DisplayFiles(dirEntries []fs.DirEntry, directoryPath string, optionFlags map[string]bool, outputWriter io.Writer, captureOutput bool) {
 	if optionFlags["l"] {
 		// For directory listings, always print the "total" line.
-		DisplayLongFormat(dirEntries, directoryPath, outputWriter, captureOutput, true)
+		DisplayLongFormat(dirEntries, directoryPath, optionFlags, outputWriter, captureOutput, true)
 	} else {
+		RecordEntries(dirEntries, directoryPath, outputWriter)
+		names := make([]string, len(dirEntries))
 		for index, entry := range dirEntries {
-			if index > 0 {
-				fmt.Fprint(outputWriter, "  ")
-			}
 			entryInfo, err := entry.Info()
 			if err != nil {
-				fmt.Fprint(outputWriter, entry.Name())
+				names[index] = entry.Name()
 			} else {
-				fmt.Fprint(outputWriter, colorize.ColorizeName(entry, entryInfo, captureOutput))
+				names[index] = colorizeEntry(entry, entryInfo, directoryPath, captureOutput)
 			}
 		}
-		if len(dirEntries) > 0 {
-			fmt.Fprintln(outputWriter)
-		}
+		printColumns(names, output.TerminalWidth(), outputWriter)
 	}
 }
 
 // DisplayLongFormat prints detailed file information in a long listing format,
 // similar to "ls -l", showing permissions, links, owner, group, size, modification time,
 // and file name. The parameter printTotal indicates whether to print the "total" line.
-func DisplayLongFormat(dirEntries []fs.DirEntry, directoryPath string, outputWriter io.Writer, captureOutput bool, printTotal bool) {
+// Symbolic link targets are shown as a full chain with "link-chain" and as a
+// canonical absolute path with "resolve".
+// Entries that cannot be stat'ed are still shown, with "?" in place of the
+// missing fields as GNU ls does, and reported on stderr.
+func DisplayLongFormat(dirEntries []fs.DirEntry, directoryPath string, optionFlags map[string]bool, outputWriter io.Writer, captureOutput bool, printTotal bool) {
+	RecordEntries(dirEntries, directoryPath, outputWriter)
+	displayLong(dirEntries, directoryPath, "", "\n", optionFlags, outputWriter, captureOutput, printTotal)
+}
+
+// DisplayFlat prints each entry on its own line as namePrefix followed by
+// its name, for --flat listings. Lines end with terminator ("\n", or "\x00"
+// for --zero). With "-l" the long format columns precede the path, their
+// widths fitted to dirEntries alone: a flat listing is printed a directory
+// at a time, so columns only line up within each directory.
+func DisplayFlat(dirEntries []fs.DirEntry, directoryPath string, namePrefix string, optionFlags map[string]bool, outputWriter io.Writer, captureOutput bool, terminator string) {
+	RecordEntries(dirEntries, directoryPath, outputWriter)
+	if optionFlags["l"] {
+		displayLong(dirEntries, directoryPath, namePrefix, terminator, optionFlags, outputWriter, captureOutput, false)
+		return
+	}
+	for _, entry := range dirEntries {
+		entryInfo, err := entry.Info()
+		if err != nil {
+			fmt.Fprint(outputWriter, namePrefix+entry.Name()+terminator)
+		} else {
+			fmt.Fprint(outputWriter, namePrefix+colorizeEntry(entry, entryInfo, directoryPath, captureOutput)+terminator)
+		}
+	}
+}
+
+// RecordEntries passes the entries listed from directoryPath to the
+// structured (--sink json or csv) destinations of outputWriter, if any.
+// The . and .. entries of -a are left out: they name the directory and its
+// parent, which are recorded as entries of their own parents.
+func RecordEntries(dirEntries []fs.DirEntry, directoryPath string, outputWriter io.Writer) {
+	recorder, ok := outputWriter.(output.Recorder)
+	if !ok {
+		return
+	}
+	for _, entry := range dirEntries {
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		recorder.Record(entryPath(directoryPath, entry.Name()), entry)
+	}
+}
+
+// displayLong prints the long format rows shared by DisplayLongFormat and
+// DisplayFlat, prefixing every name with namePrefix.
+func displayLong(dirEntries []fs.DirEntry, directoryPath string, namePrefix string, terminator string, optionFlags map[string]bool, outputWriter io.Writer, captureOutput bool, printTotal bool) {
 	maxLinksWidth := 0
 	maxOwnerWidth := 0
 	maxGroupWidth := 0
 	maxSizeWidth := 0
+	maxCountWidth := 0
 
 	// Calculate maximum widths for formatting.
+	// Fields of unreadable entries are a single "?", which every width covers.
 	for _, entry := range dirEntries {
 		entryInfo, err := entry.Info()
+		maxCountWidth = max(maxCountWidth, width.StringWidth(childCount(entry)))
 		if err != nil {
+			maxLinksWidth = max(maxLinksWidth, 1)
+			maxOwnerWidth = max(maxOwnerWidth, 1)
+			maxGroupWidth = max(maxGroupWidth, 1)
+			maxSizeWidth = max(maxSizeWidth, 1)
 			continue
 		}
 		stat := entryInfo.Sys().(*syscall.Stat_t)
@@ -58,12 +115,12 @@ func DisplayLongFormat(dirEntries []fs.DirEntry, directoryPath string, outputWri
 			maxLinksWidth = len(linksStr)
 		}
 		ownerName := utils.GetOwner(entryInfo)
-		if len(ownerName) > maxOwnerWidth {
-			maxOwnerWidth = len(ownerName)
+		if width.StringWidth(ownerName) > maxOwnerWidth {
+			maxOwnerWidth = width.StringWidth(ownerName)
 		}
 		groupName := utils.GetGroup(entryInfo)
-		if len(groupName) > maxGroupWidth {
-			maxGroupWidth = len(groupName)
+		if width.StringWidth(groupName) > maxGroupWidth {
+			maxGroupWidth = width.StringWidth(groupName)
 		}
 		var sizeField string
 		if entryInfo.Mode()&os.ModeDevice != 0 {
@@ -96,19 +153,23 @@ func DisplayLongFormat(dirEntries []fs.DirEntry, directoryPath string, outputWri
 
 	// Print each entry.
 	for _, entry := range dirEntries {
+		countColumn := width.PadLeft(childCount(entry), maxCountWidth)
 		entryInfo, err := entry.Info()
 		if err != nil {
+			status.ReportError(status.Minor, "cannot access", entryPath(directoryPath, entry.Name()), err)
+			fmt.Fprint(outputWriter, longRow(optionFlags,
+				utils.GetFileType(entry.Type())+"?????????",
+				fmt.Sprintf("%*s", maxLinksWidth, "?"),
+				width.PadRight("?", maxOwnerWidth),
+				width.PadRight("?", maxGroupWidth),
+				countColumn,
+				fmt.Sprintf("%*s", maxSizeWidth, "?"),
+				fmt.Sprintf("%12s", "?"),
+				namePrefix+entry.Name())+terminator)
 			continue
 		}
 		stat := entryInfo.Sys().(*syscall.Stat_t)
-		coloredName := colorize.ColorizeName(entry, entryInfo, captureOutput)
-		// If the file is a symlink, append the link target.
-		if entry.Type()&os.ModeSymlink != 0 {
-			linkTarget, err := os.Readlink(filepath.Join(directoryPath, entry.Name()))
-			if err == nil {
-				coloredName = coloredName + " -> " + linkTarget
-			}
-		}
+		coloredName := EntryName(entry, entryInfo, directoryPath, optionFlags, captureOutput)
 		var sizeField string
 		if entryInfo.Mode()&os.ModeDevice != 0 {
 			major := (stat.Rdev >> 8) & 0xff
@@ -117,15 +178,139 @@ func DisplayLongFormat(dirEntries []fs.DirEntry, directoryPath string, outputWri
 		} else {
 			sizeField = fmt.Sprintf("%d", entryInfo.Size())
 		}
-		fmt.Fprintf(outputWriter, "%s %*d %-*s %-*s %*s %12s %s\n",
+		// Owner and group are padded by display width, not byte length,
+		// so names with wide or combining characters stay aligned.
+		fmt.Fprint(outputWriter, longRow(optionFlags,
 			utils.GetPermissions(entryInfo),
-			maxLinksWidth, stat.Nlink,
-			maxOwnerWidth, utils.GetOwner(entryInfo),
-			maxGroupWidth, utils.GetGroup(entryInfo),
-			maxSizeWidth, sizeField,
-			formatModTime(entryInfo),
-			coloredName)
+			fmt.Sprintf("%*d", maxLinksWidth, stat.Nlink),
+			width.PadRight(utils.GetOwner(entryInfo), maxOwnerWidth),
+			width.PadRight(utils.GetGroup(entryInfo), maxGroupWidth),
+			countColumn,
+			fmt.Sprintf("%*s", maxSizeWidth, sizeField),
+			fmt.Sprintf("%12s", formatModTime(entryInfo)),
+			namePrefix+coloredName)+terminator)
+	}
+}
+
+// longRow joins the fields of one long format row, leaving out the columns
+// --columns does not select. The --count column sits right before the size.
+func longRow(optionFlags map[string]bool, permissions string, links string, owner string, group string, count string, size string, modified string, name string) string {
+	var fields []string
+	for _, column := range []struct {
+		shown bool
+		field string
+	}{
+		{optionFlags["column-permissions"], permissions},
+		{optionFlags["column-links"], links},
+		{optionFlags["column-owner"], owner},
+		{optionFlags["column-group"], group},
+		{optionFlags["count"], count},
+		{optionFlags["column-size"], size},
+		{optionFlags["column-time"], modified},
+	} {
+		if column.shown {
+			fields = append(fields, column.field)
+		}
+	}
+	return strings.Join(append(fields, name), " ")
+}
+
+// childCount returns the --count value of a directory entry, or "-" for
+// entries that are not counted directories.
+func childCount(entry fs.DirEntry) string {
+	if counted, ok := entry.(interface{ ChildCount() string }); ok {
+		return counted.ChildCount()
+	}
+	return "-"
+}
+
+// EntryName returns the name of an entry listed from directoryPath as the
+// long format shows it: colored by type and, for a symbolic link, followed
+// by its target.
+func EntryName(entry fs.DirEntry, entryInfo os.FileInfo, directoryPath string, optionFlags map[string]bool, captureOutput bool) string {
+	name := colorizeEntry(entry, entryInfo, directoryPath, captureOutput)
+	if entry.Type()&os.ModeSymlink != 0 {
+		name += formatLinkTarget(entryPath(directoryPath, entry.Name()), optionFlags, captureOutput)
+	}
+	return name
+}
+
+// colorizeEntry colors an entry by type, marking symbolic links that
+// do not resolve with the orphan color.
+func colorizeEntry(entry fs.DirEntry, entryInfo os.FileInfo, directoryPath string, captureOutput bool) string {
+	if entry.Type()&os.ModeSymlink != 0 {
+		if _, err := os.Stat(entryPath(directoryPath, entry.Name())); err != nil {
+			return colorize.ColorizeOrphan(entry.Name(), captureOutput)
+		}
+	}
+	return colorize.ColorizeName(entry, entryInfo, captureOutput)
+}
+
+// formatLinkTarget returns the " -> target" suffix for the link at linkPath.
+// Targets are colored by the type of the file they finally name; missing
+// targets use the "mi" color, and a link that does not resolve is marked
+// [dangling] or [loop] whichever way its target is shown.
+func formatLinkTarget(linkPath string, optionFlags map[string]bool, captureOutput bool) string {
+	chain := utils.ResolveLink(linkPath)
+	if len(chain.Targets) == 0 {
+		return ""
+	}
+	broken := chain.Dangling || chain.Loop
+
+	marker := ""
+	if chain.Loop {
+		marker = " [loop]"
+	} else if chain.Dangling {
+		marker = " [dangling]"
+	}
+
+	if optionFlags["resolve"] {
+		if broken {
+			return " -> " + colorize.ColorizeMissing(chain.Targets[0], captureOutput) + marker
+		}
+		resolvedPath, err := filepath.EvalSymlinks(linkPath)
+		if err == nil {
+			resolvedPath, err = filepath.Abs(resolvedPath)
+		}
+		if err != nil {
+			return " -> " + chain.Targets[0]
+		}
+		return " -> " + colorize.ColorizePath(resolvedPath, chain.FinalInfo, captureOutput)
+	}
+
+	if optionFlags["link-chain"] {
+		suffix := ""
+		for index, target := range chain.Targets {
+			switch {
+			case index < len(chain.Targets)-1:
+				hopInfo, err := os.Lstat(chain.Paths[index])
+				if err != nil {
+					suffix += " -> " + target
+				} else {
+					suffix += " -> " + colorize.ColorizePath(target, hopInfo, captureOutput)
+				}
+			case broken:
+				suffix += " -> " + colorize.ColorizeMissing(target, captureOutput)
+			default:
+				suffix += " -> " + colorize.ColorizePath(target, chain.FinalInfo, captureOutput)
+			}
+		}
+		return suffix + marker
+	}
+
+	if broken {
+		return " -> " + colorize.ColorizeMissing(chain.Targets[0], captureOutput) + marker
+	}
+	return " -> " + colorize.ColorizePath(chain.Targets[0], chain.FinalInfo, captureOutput)
+}
+
+// entryPath returns the path of an entry listed from directoryPath.
+// Absolute names (command line operands) are used as they are.
+func entryPath(directoryPath string, name string) string {
+	if filepath.IsAbs(name) {
+		return name
 	}
+	return filepath.Join(directoryPath, name)
 }
 
 func formatModTime(entryInfo os.FileInfo) string {
@@ -0,0 +1,148 @@
+package du
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+	"eles/walk"
+)
+
+// Size is the disk usage of a directory tree.
+type Size struct {
+	Apparent  int64 // Sum of file sizes.
+	Allocated int64 // Bytes of disk blocks allocated.
+}
+
+// InodeSet remembers hard-linked files already counted, so every inode
+// contributes to the totals once. It is safe for concurrent use.
+type InodeSet struct {
+	mutex sync.Mutex
+	seen  map[utils.FileID]bool
+}
+
+// NewInodeSet returns an empty InodeSet.
+func NewInodeSet() *InodeSet {
+	return &InodeSet{seen: make(map[utils.FileID]bool)}
+}
+
+// FirstVisit reports whether the file has not been counted yet.
+func (s *InodeSet) FirstVisit(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink <= 1 || info.IsDir() {
+		return true
+	}
+	id := utils.GetFileID(info)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.seen[id] {
+		return false
+	}
+	s.seen[id] = true
+	return true
+}
+
+// MeasureOptions returns the walk options for measuring a tree: every file
+// is counted, whatever the listing hides or prunes, but -x, -L and
+// --follow still apply.
+func MeasureOptions(options flags.Options) flags.Options {
+	measure := options
+	measure.ShowAll = true
+	measure.MaxDepth = -1
+	measure.Prune = nil
+	measure.Ignore = nil
+	return measure
+}
+
+// FileSize returns the apparent and allocated size of one file.
+func FileSize(info os.FileInfo) Size {
+	size := Size{Apparent: info.Size()}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		size.Allocated = stat.Blocks * 512
+	}
+	return size
+}
+
+// measure returns the size of the directory at directoryPath and everything
+// below it, with the unreadable parts reported to diagnostics.
+func measure(directoryPath string, directoryInfo os.FileInfo, options flags.Options, inodes *InodeSet, diagnostics *status.Queue) Size {
+	total := FileSize(directoryInfo)
+	walk.WalkQueued(directoryPath, MeasureOptions(options), diagnostics, func(entryPath string, entryInfo os.FileInfo, depth int) {
+		if !inodes.FirstVisit(entryInfo) {
+			return
+		}
+		entrySize := FileSize(entryInfo)
+		total.Apparent += entrySize.Apparent
+		total.Allocated += entrySize.Allocated
+	})
+	return total
+}
+
+// Measure returns the size of the tree rooted at directoryPath.
+func Measure(directoryPath string, options flags.Options) (Size, error) {
+	directoryInfo, err := os.Stat(directoryPath)
+	if err != nil {
+		return Size{}, err
+	}
+	return measure(directoryPath, directoryInfo, options, NewInodeSet(), nil), nil
+}
+
+// totalInfo is the FileInfo of a directory with its size replaced by the
+// size of its whole tree (--du). Sys returns a copy of the stat data with
+// the size and block count updated, so the "total" line adds up as well.
+type totalInfo struct {
+	os.FileInfo
+	size int64
+	stat *syscall.Stat_t
+}
+
+func (t *totalInfo) Size() int64 { return t.size }
+func (t *totalInfo) Sys() any    { return t.stat }
+
+// Annotate replaces every directory among dirEntries (except "..") with an
+// entry reporting the total size of its tree, apparent or allocated as
+// chosen by --du. Subtrees are measured concurrently by the idle workers
+// of the listing (see utils.Workers). Each directory is measured on its own, as du DIR would measure
+// it: a file hard-linked into several of them counts toward each, and
+// only once within each. Unreadable subtrees are reported to diagnostics.
+func Annotate(dirEntries []fs.DirEntry, directoryPath string, options flags.Options, workers utils.Workers, diagnostics *status.Queue) []fs.DirEntry {
+	var group sync.WaitGroup
+
+	for index, entry := range dirEntries {
+		if entry.Name() == ".." {
+			continue
+		}
+		entryInfo, err := entry.Info()
+		if err != nil || !entryInfo.IsDir() {
+			continue
+		}
+		stat, ok := entryInfo.Sys().(*syscall.Stat_t)
+		if !ok {
+			continue
+		}
+
+		entryPath := entry.Name()
+		if !filepath.IsAbs(entryPath) {
+			entryPath = filepath.Join(directoryPath, entryPath)
+		}
+
+		totalStat := *stat
+		workers.Go(&group, func() {
+			total := measure(entryPath, entryInfo, options, NewInodeSet(), diagnostics)
+			totalStat.Size = total.Apparent
+			totalStat.Blocks = total.Allocated / 512
+			shown := total.Apparent
+			if options.DiskUsage == "allocated" {
+				shown = total.Allocated
+			}
+			dirEntries[index] = utils.NewPseudoDirEntry(&totalInfo{FileInfo: entryInfo, size: shown, stat: &totalStat}, dirEntries[index].Name())
+		})
+	}
+	group.Wait()
+	return dirEntries
+}
@@ -0,0 +1,132 @@
+package du
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"eles/filter"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+	"eles/walk"
+)
+
+// Report prints the disk usage of each path of options and of the
+// directories below them (myls du), one "SIZE<tab>PATH" line each, in
+// bytes and with subdirectories before their parent as du does. Sizes are
+// allocated unless --apparent-size is given, and hard links are counted
+// once across all the paths. --max-depth limits the directories printed,
+// not the ones counted; -a prints files as well and -s only the paths.
+func Report(options flags.Options, outputWriter io.Writer) {
+	reporter := &reporter{
+		options:      options,
+		outputWriter: outputWriter,
+		inodes:       NewInodeSet(),
+		ancestors:    make(walk.Ancestors),
+	}
+	// Every entry is counted, dot files included, and every directory
+	// entered; only --ignore leaves some out.
+	reporter.walkOptions = options
+	reporter.walkOptions.ShowAll = true
+	reporter.walkOptions.MaxDepth = -1
+
+	for _, rootPath := range options.Paths {
+		rootInfo, err := os.Stat(rootPath)
+		if err != nil {
+			status.ReportError(status.Serious, "cannot access", rootPath, err)
+			continue
+		}
+		reporter.descent = walk.Descent{Options: reporter.walkOptions, RootDevice: utils.DeviceID(rootInfo)}
+		reporter.total(rootPath, rootInfo, 0)
+	}
+}
+
+// reporter holds the state of one Report call.
+type reporter struct {
+	options      flags.Options
+	walkOptions  flags.Options
+	outputWriter io.Writer
+	inodes       *InodeSet
+	descent      walk.Descent
+	ancestors    walk.Ancestors
+}
+
+// total returns the size of the file or tree at entryPath, depth levels
+// below its path operand, printing it and the totals below it as chosen.
+// A directory that leads back to one of its ancestors is reported and
+// left out.
+func (r *reporter) total(entryPath string, entryInfo os.FileInfo, depth int) int64 {
+	if entryInfo.IsDir() {
+		if !r.ancestors.Enter(entryInfo) {
+			walk.ReportLoop(entryPath)
+			return 0
+		}
+		defer r.ancestors.Leave(entryInfo)
+	}
+
+	var size int64
+	if r.inodes.FirstVisit(entryInfo) {
+		size = r.sizeOf(FileSize(entryInfo))
+	}
+	if entryInfo.IsDir() {
+		size += r.totalBelow(entryPath, depth)
+	}
+	if r.prints(entryInfo, depth) {
+		fmt.Fprintf(r.outputWriter, "%d\t%s\n", size, entryPath)
+	}
+	return size
+}
+
+// totalBelow returns the size of everything in the directory at
+// directoryPath.
+func (r *reporter) totalBelow(directoryPath string, depth int) int64 {
+	dirEntries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		status.ReportError(status.Minor, "cannot read directory", directoryPath, err)
+		return 0
+	}
+	var size int64
+	for _, entry := range filter.Apply(dirEntries, r.walkOptions, directoryPath) {
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		entryPath := filepath.Join(directoryPath, entry.Name())
+		entryInfo, err := entry.Info()
+		if err != nil {
+			status.ReportError(status.Minor, "cannot access", entryPath, err)
+			continue
+		}
+		if directoryInfo := r.descent.Into(entry, entryPath, entryInfo, depth+1); directoryInfo != nil {
+			entryInfo = directoryInfo
+		} else if entryInfo.IsDir() {
+			// Only -x keeps a directory out, and du -x leaves it out entirely.
+			continue
+		}
+		size += r.total(entryPath, entryInfo, depth+1)
+	}
+	return size
+}
+
+// sizeOf returns the apparent or allocated size, as --apparent-size chooses.
+func (r *reporter) sizeOf(size Size) int64 {
+	if r.options.ApparentSize {
+		return size.Apparent
+	}
+	return size.Allocated
+}
+
+// prints reports whether the total of an entry depth levels below its
+// path operand is printed.
+func (r *reporter) prints(entryInfo os.FileInfo, depth int) bool {
+	switch {
+	case depth == 0:
+		return true
+	case r.options.Summarize:
+		return false
+	case !entryInfo.IsDir() && !r.options.AllFiles:
+		return false
+	}
+	return r.options.MaxDepth < 0 || depth <= r.options.MaxDepth
+}
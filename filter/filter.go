@@ -4,6 +4,10 @@ import (
 	"io/fs"         
 	"os"            
 	"path/filepath" 
+	"strings"
+	"sync"
+
+	"eles/flags"
 )
 
 type pseudoDirectoryEntry struct {
@@ -53,8 +57,28 @@ func GetParentDir(directoryPath string) string {
 	return filepath.Dir(directoryPath)
 }
 
+// Replaces symbolic links with entries describing their targets ("-L" flag).
+// Dangling links are kept as they are.
+func DereferenceFiles(dirEntries []fs.DirEntry, directoryPath string) []fs.DirEntry {
+	for index, entry := range dirEntries {
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		targetInfo, err := os.Stat(filepath.Join(directoryPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		dirEntries[index] = &pseudoDirectoryEntry{entryName: entry.Name(), fileInfo: targetInfo}
+	}
+	return dirEntries
+}
+
 // Filters directory entries based on the "-a" flag.
+// With the "-L" flag symbolic links are dereferenced as well.
 func FilterFiles(dirEntries []fs.DirEntry, flags map[string]bool, directoryPath string) []fs.DirEntry {
+	if flags["L"] {
+		dirEntries = DereferenceFiles(dirEntries, directoryPath)
+	}
 	if flags["a"] {
 		var pseudoEntries []fs.DirEntry
 		// Create a pseudo entry for the current directory "."
@@ -80,3 +104,88 @@ func FilterFiles(dirEntries []fs.DirEntry, flags map[string]bool, directoryPath
 	}
 	return visibleEntries
 }
+
+// Reports whether a directory matches one of the --prune patterns.
+// Patterns without a slash match the directory name, others the whole path.
+func Pruned(directoryPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		subject := filepath.Base(directoryPath)
+		if strings.Contains(pattern, "/") {
+			subject = filepath.Clean(directoryPath)
+		}
+		if matched, _ := filepath.Match(pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedFiles holds the absolute paths registered with ExcludeFile.
+// Files are registered as they are created, while directories are read.
+var (
+	excludedMutex sync.RWMutex
+	excludedFiles = make(map[string]bool)
+)
+
+// Registers a file that is never listed, such as the capture file the
+// listing is being written to.
+func ExcludeFile(filePath string) {
+	if absolutePath, err := filepath.Abs(filePath); err == nil {
+		excludedMutex.Lock()
+		excludedFiles[absolutePath] = true
+		excludedMutex.Unlock()
+	}
+}
+
+// Reports whether any file was registered with ExcludeFile.
+func hasExclusions() bool {
+	excludedMutex.RLock()
+	defer excludedMutex.RUnlock()
+	return len(excludedFiles) > 0
+}
+
+// Reports whether the entry name of directoryPath was registered with ExcludeFile.
+func excluded(directoryPath string, name string) bool {
+	absoluteDirectory, err := filepath.Abs(directoryPath)
+	if err != nil {
+		return false
+	}
+	excludedMutex.RLock()
+	defer excludedMutex.RUnlock()
+	return excludedFiles[filepath.Join(absoluteDirectory, name)]
+}
+
+// Filters directory entries with every rule of the listing: FilterFiles for
+// "-a" and "-L", then the -I/--ignore patterns, the --hide patterns unless
+// "-a" is given, and the files registered with ExcludeFile.
+func Apply(dirEntries []fs.DirEntry, options flags.Options, directoryPath string) []fs.DirEntry {
+	dirEntries = FilterFiles(dirEntries, options.ToMap(), directoryPath)
+	if len(options.Ignore) == 0 && (len(options.Hide) == 0 || options.ShowAll) && !hasExclusions() {
+		return dirEntries
+	}
+
+	var keptEntries []fs.DirEntry
+	for _, entry := range dirEntries {
+		if matchesAny(entry.Name(), options.Ignore) {
+			continue
+		}
+		if !options.ShowAll && matchesAny(entry.Name(), options.Hide) {
+			continue
+		}
+		if excluded(directoryPath, entry.Name()) {
+			continue
+		}
+		keptEntries = append(keptEntries, entry)
+	}
+	return keptEntries
+}
+
+// Reports whether name matches one of the shell patterns.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Command describes a subcommand, run as "myls NAME [options] OPERANDS".
+// It takes options of its own and the listing options it shares, so its
+// options, help and completion come from the same table as the listing's.
+type Command struct {
+	Name     string
+	Operands string   // Synopsis of the operands, e.g. "[path...]".
+	Paths    int      // Number of operands it needs; 0 for any, the current directory when none is given.
+	Help     string   // One line summary for myls --help.
+	Detail   string   // Description for myls NAME --help and the man page.
+	Options  []Option // Options of the command alone; their letters may differ in meaning from the listing's.
+	Shared   []string // Keys (long name, or letter) of the listing options it accepts as well.
+}
+
+// common lists the listing options every subcommand shares: those about
+// where the output goes and how problems are reported, the configuration
+// selection and the help.
+var common = []string{"pager", "output", "errors", "no-config", "profile", "help"}
+
+// selectionOptions lists the listing options choosing which entries of a
+// tree are visited, shared by the subcommands walking trees.
+var selectionOptions = []string{"all", "ignore", "hide", "prune", "max-depth", "one-file-system", "follow"}
+
+// commandTable lists every subcommand.
+var commandTable = []Command{
+	{
+		Name: "tree", Operands: "[path...]",
+		Help:   "Show directories as indented trees",
+		Detail: "Show each directory and everything below it as an indented tree, followed by the number of directories and files shown. Entries are selected and sorted as in a listing, .mylsrc preferences included, and --count shows the number of entries of each directory after its name.",
+		Options: []Option{
+			describe(switchOption("dirs-only", 'd', func(o *Options) *bool { return &o.DirsOnly }),
+				"", "List directories only", ""),
+		},
+		Shared: slices.Concat(selectionOptions, []string{"sort", "t", "S", "U", "v", "reverse", "count", "dirconfig", "trust-dirconfig", "color"}, common),
+	},
+	{
+		Name: "du", Operands: "[path...]",
+		Help:   "Print the disk usage of each directory of the trees",
+		Detail: "Print the disk usage of each directory below the paths, and of the paths themselves, in bytes, subdirectories before their parent. Hard links are counted once; entries left out with --ignore are not counted.",
+		Options: []Option{
+			describe(switchOption("all-files", 'a', func(o *Options) *bool { return &o.AllFiles }),
+				"", "Print the size of files as well as directories", ""),
+			describe(switchOption("summarize", 's', func(o *Options) *bool { return &o.Summarize }),
+				"", "Print only the total of each path", ""),
+			withDefault(describe(switchOption("apparent-size", 0, func(o *Options) *bool { return &o.ApparentSize }),
+				"", "Count file sizes rather than the disk space allocated to them", ""), "allocated space"),
+		},
+		Shared: slices.Concat([]string{"ignore", "max-depth", "one-file-system", "follow"}, common),
+	},
+	{
+		Name: "diff", Operands: "LEFT RIGHT", Paths: 2,
+		Help:   "Compare two directory trees",
+		Detail: "Compare the trees of the directories LEFT and RIGHT: entries only in LEFT are marked -, entries only in RIGHT +, and entries in both that differ in type, size, permissions or link target ~, with what changed. A directory found on one side only is reported without its contents. The exit status is 0 when the trees are the same, 1 when they differ and 2 on trouble, as with diff(1).",
+		Options: []Option{
+			describe(switchOption("content", 0, func(o *Options) *bool { return &o.Content }),
+				"", "Also compare the contents of regular files of the same size", ""),
+			describe(switchOption("times", 0, func(o *Options) *bool { return &o.Times }),
+				"", "Also compare modification times", ""),
+		},
+		Shared: slices.Concat(selectionOptions, []string{"color"}, common),
+	},
+	{
+		Name: "stat", Operands: "[path...]",
+		Help:   "Print everything known about files",
+		Detail: "Print the type, size, permissions, owner, group, links, inode, device and times of each path, or of the current directory when none is given, and the target of symbolic links.",
+		Options: []Option{
+			withDefault(describe(choiceOption("format", false, []string{"text", "json"}, func(o *Options) *string { return &o.Format }),
+				"", "Print the details as text or as one JSON object per path", ""), "text"),
+		},
+		Shared: slices.Concat([]string{"dereference"}, common),
+	},
+}
+
+// Commands returns the table of every subcommand.
+func Commands() []Command {
+	return commandTable
+}
+
+// LookupCommand returns the subcommand with the given name, or nil.
+func LookupCommand(name string) *Command {
+	for index := range commandTable {
+		if commandTable[index].Name == name {
+			return &commandTable[index]
+		}
+	}
+	return nil
+}
+
+// Table returns the options the command accepts: its own, then the
+// shared ones in the order of Shared.
+func (c *Command) Table() []Option {
+	options := slices.Clone(c.Options)
+	for _, key := range c.Shared {
+		for _, option := range optionTable {
+			if option.key() == key {
+				options = append(options, option)
+			}
+		}
+	}
+	return options
+}
+
+// ParseCommand parses the arguments following the name of a subcommand.
+// The defaults (see ParseArgs) only set the listing options the command
+// shares and the others are skipped, so a configuration written for the
+// listing does not get in the way; on the command line an option the
+// command does not take is an error.
+func ParseCommand(command *Command, defaults []string, args []string) Options {
+	opts := parse(defaults, args, command)
+	switch {
+	case command.Paths > 0 && len(opts.Paths) != command.Paths:
+		fmt.Printf("myls %s takes %d paths: %s\n", command.Name, command.Paths, command.Operands)
+		fmt.Printf("Try 'myls %s --help' for more information.\n", command.Name)
+		os.Exit(1)
+	case command.Paths == 0 && len(opts.Paths) == 0:
+		opts.Paths = append(opts.Paths, ".")
+	}
+	return opts
+}
+
+// scope is the set of options an argument is parsed against: the whole
+// table for the listing; for a subcommand its own options, on the command
+// line only, and the listing options it shares.
+type scope struct {
+	command     *Command // nil for the listing.
+	commandLine bool     // The argument was given on the command line rather than by the defaults.
+}
+
+// long returns the option of the scope with the given long name, or nil.
+func (s scope) long(name string) *Option {
+	if s.command == nil {
+		return Lookup(name)
+	}
+	if s.commandLine {
+		for index := range s.command.Options {
+			if name != "" && s.command.Options[index].Name == name {
+				return &s.command.Options[index]
+			}
+		}
+	}
+	if option := Lookup(name); option != nil && slices.Contains(s.command.Shared, option.key()) {
+		return option
+	}
+	return nil
+}
+
+// short returns the option of the scope with the given letter, or nil.
+func (s scope) short(short rune) *Option {
+	if s.command == nil {
+		return lookupShort(short)
+	}
+	if s.commandLine {
+		for index := range s.command.Options {
+			if s.command.Options[index].Short == short {
+				return &s.command.Options[index]
+			}
+		}
+	}
+	if option := lookupShort(short); option != nil && slices.Contains(s.command.Shared, option.key()) {
+		return option
+	}
+	return nil
+}
+
+// lenient reports whether options out of the scope are skipped rather
+// than rejected: those of the defaults of a subcommand.
+func (s scope) lenient() bool {
+	return s.command != nil && !s.commandLine
+}
+
+// program returns how the scope is invoked: "myls", or "myls NAME".
+func (s scope) program() string {
+	if s.command == nil {
+		return "myls"
+	}
+	return "myls " + s.command.Name
+}
+
+// printUsage prints the help of the scope: the listing's, or the command's.
+func (s scope) printUsage() {
+	if s.command == nil {
+		printUsage()
+		return
+	}
+	printCommandUsage(s.command)
+}
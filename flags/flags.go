@@ -3,52 +3,167 @@ package flags
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Options holds parsed flag values and file/directory paths.
 type Options struct {
-	Long      bool     //(-l)
-	Recursive bool     //  (-R)
-	ShowAll   bool     // (-a)
-	TimeSort  bool     //  (-t)
-	Reverse   bool     // (-r)
-	Capture   bool     // (-c)
-	Paths     []string 
+	Long                   bool     //(-l)
+	Recursive              bool     //  (-R)
+	ShowAll                bool     // (-a)
+	TimeSort               bool     //  (-t)
+	SizeSort               bool     // (-S)
+	NoSort                 bool     // (-U)
+	VersionSort            bool     // (-v)
+	Reverse                bool     // (-r)
+	Capture                bool     // (-c)
+	OutputPath             string   // (--output=FILE), "-" for stdout only
+	Append                 bool     // (--append)
+	NoClobber              bool     // (--no-clobber)
+	Compress               string   // (--compress=gzip|zstd|none), by extension when empty
+	Rotate                 bool     // (--rotate)
+	RotateSize             int64    // (--rotate-size=SIZE)
+	Keep                   int      // (--keep=N), 0 keeps every rotated file
+	Color                  string   // (--color=auto|always|never)
+	Pager                  bool     // (--pager)
+	Sinks                  []Sink   // (--sink=PATH[:FORMAT[:color]])
+	Directory              bool     // (-d)
+	Dereference            bool     // (-L)
+	DereferenceCommandLine bool     // (-H)
+	DereferenceDirArgs     bool     // (--dereference-command-line-symlink-to-dir)
+	OneFileSystem          bool     // (-x)
+	MaxDepth               int      // (--max-depth=N), -1 when unlimited
+	MinDepth               int      // (--min-depth=N)
+	Prune                  []string // (--prune=PATTERN)
+	Ignore                 []string // (-I, --ignore=PATTERN)
+	Hide                   []string // (--hide=PATTERN)
+	Count                  string   // (--count[=immediate|recursive])
+	Stats                  string   // (--stats[=text|json])
+	Top                    int      // (--top=N)
+	TopBy                  string   // (--by=size|mtime|atime)
+	Usage                  string   // (--usage=owner|group)
+	UsageFormat            string   // (--usage-format=table|csv|json)
+	UsageSort              string   // (--usage-sort=bytes|allocated|files|name)
+	StatsOnly              bool     // (--stats-only)
+	Follow                 bool     // (--follow)
+	DiskUsage              string   // (--du[=apparent|allocated])
+	Jobs                   int      // (--jobs=N), 0 for one per CPU
+	Traversal              string   // (--traversal=depth|breadth|post)
+	Flat                   bool     // (--flat)
+	Absolute               bool     // (--absolute)
+	Tilde                  bool     // (--tilde)
+	Zero                   bool     // (--zero)
+	LinkChain              bool     // (--link-chain)
+	ResolveLinks           bool     // (--resolve)
+	AmbiguousWide          bool     // (--ambiguous-width=wide)
+	ErrorFormat            string   // (--errors=text|json)
+	Columns                []string // (--columns=LIST), nil for every column
+	DirConfig              string   // (--dirconfig[=here|ancestors]), "" with --no-dirconfig
+	TrustDirConfig         bool     // (--trust-dirconfig)
+	Completion             string   // (--completion=bash|zsh|fish)
+	DirsOnly               bool     // (myls tree -d, --dirs-only)
+	AllFiles               bool     // (myls du -a, --all-files)
+	Summarize              bool     // (myls du -s, --summarize)
+	ApparentSize           bool     // (myls du --apparent-size)
+	Content                bool     // (myls diff --content)
+	Times                  bool     // (myls diff --times)
+	Format                 string   // (myls stat --format=text|json)
+	Paths                  []string 
+	// CommandLine holds the options given on the command line itself, by
+	// long name (or letter), as "no-NAME" when negated.
+	CommandLine map[string]bool
 }
 
-func ParseArgs(args []string) Options {
-	var opts Options
+// Sink is an extra destination of the listing given with --sink.
+type Sink struct {
+	Path   string // File name, or "-" for stdout.
+	Format string // "text", "json" or "csv".
+	Color  bool   // Keep the ANSI colors of text output.
+}
+
+// LongColumns lists the columns of the long format --columns can select,
+// in the order they are printed. The name is always shown.
+var LongColumns = []string{"permissions", "links", "owner", "group", "size", "time"}
+
+// ParseArgs parses the defaults read from the configuration (see the config
+// package) followed by the command line arguments. The options given in
+// args are recorded in CommandLine, so defaults of a lower precedence, such
+// as a directory's .mylsrc, can leave them alone.
+func ParseArgs(defaults []string, args []string) Options {
+	opts := parse(defaults, args, nil)
+	// if no paths provided, use current directory.
+	if len(opts.Paths) == 0 {
+		opts.Paths = append(opts.Paths, ".")
+	}
+	return opts
+}
+
+// parse parses the defaults followed by args against the options of
+// command, or of the listing when command is nil.
+func parse(defaults []string, args []string, command *Command) Options {
+	opts := Options{MaxDepth: -1, TopBy: "size", UsageFormat: "table", UsageSort: "bytes", DirConfig: "here", CommandLine: make(map[string]bool)}
 	endOfOptions := false
+	args = append(append([]string{}, defaults...), args...)
 
-	for _, arg := range args {
-		
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		fromCommandLine := index >= len(defaults)
+		options := scope{command: command, commandLine: fromCommandLine}
 		if !endOfOptions && len(arg) > 0 && arg[0] == '-' {
 				if arg == "--" {
 				endOfOptions = true
 				continue
 			}
+			if strings.HasPrefix(arg, "--") {
+				given := parseLongOption(&opts, arg[2:], options)
+				if fromCommandLine && given != "" {
+					opts.CommandLine[given] = true
+				}
+				continue
+			}
 			
-			for _, ch := range arg[1:] {
-				switch ch {
-				case 'l':
-					opts.Long = true
-				case 'R':
-					opts.Recursive = true
-				case 'a':
-					opts.ShowAll = true
-				case 't':
-					opts.TimeSort = true
-				case 'r':
-					opts.Reverse = true
-				case 'c':
-					opts.Capture = true
-				case 'h':
-					printUsage()
+		shortFlags:
+			for position, ch := range arg[1:] {
+				option := options.short(ch)
+				switch {
+				case option != nil && option.Name == "help":
+					options.printUsage()
 					os.Exit(0)
-				default:
+				case option == nil && options.lenient():
+					// A listing option the command does not take: skip
+					// it, with its value.
+					if skipped := lookupShort(ch); skipped != nil && skipped.Value != "" {
+						if arg[1+position+1:] == "" {
+							index++
+						}
+						break shortFlags
+					}
+				case option == nil:
 					fmt.Printf("Unknown flag: -%c\n", ch)
-					printUsage()
+					options.printUsage()
 					os.Exit(1)
+				case option.Value != "":
+					// The value is the rest of the argument, or the next one.
+					value := arg[1+position+1:]
+					if value == "" {
+						if index+1 >= len(args) {
+							fmt.Printf("Option -%c requires a %s\n", ch, strings.ToLower(option.Value))
+							os.Exit(1)
+						}
+						index++
+						value = args[index]
+					}
+					option.apply(&opts, value)
+					if fromCommandLine {
+						opts.CommandLine[option.key()] = true
+					}
+					break shortFlags
+				default:
+					option.apply(&opts, "")
+					if fromCommandLine {
+						opts.CommandLine[option.key()] = true
+					}
 				}
 			}
 			// Move on to the next argument.
@@ -58,13 +173,143 @@ func ParseArgs(args []string) Options {
 		opts.Paths = append(opts.Paths, arg)
 	}
 
-	// if no paths provided, use current directory.
-	if len(opts.Paths) == 0 {
-		opts.Paths = append(opts.Paths, ".")
+	// Rotation moves the capture file away, which appending cannot do.
+	if opts.Append && (opts.Rotate || opts.RotateSize > 0 || opts.Keep > 0) {
+		fmt.Println("Option --append cannot be combined with --rotate, --rotate-size or --keep")
+		os.Exit(1)
 	}
 	return opts
 }
 
+// parseLongOption applies a single "--name" or "--name=value" option, or
+// undoes one given as "--no-name", and returns the name it was given as,
+// or "" when a lenient scope skipped it.
+func parseLongOption(opts *Options, option string, options scope) string {
+	name, value, hasValue := strings.Cut(option, "=")
+	switch {
+	case name == "help" && options.long(name) != nil && !hasValue:
+		options.printUsage()
+		os.Exit(0)
+	case name == "help" && options.long(name) != nil:
+		printOptionHelp(value, options)
+		os.Exit(0)
+	case name == "man" && options.long(name) != nil && !hasValue:
+		printManPage()
+		os.Exit(0)
+	}
+	if entry := options.long(name); entry != nil && entry.Value == "" && hasValue {
+		fmt.Printf("Option --%s does not take a value\n", name)
+		os.Exit(1)
+	}
+	if entry := options.long(name); entry != nil && entry.apply != nil {
+		entry.checkChoice(value)
+		entry.apply(opts, value)
+		return name
+	}
+	if negated, ok := strings.CutPrefix(name, "no-"); ok && !hasValue {
+		if entry := options.long(negated); entry != nil && entry.Negatable() {
+			entry.negate(opts)
+			return name
+		}
+	}
+	if options.lenient() {
+		return ""
+	}
+	fmt.Printf("Unknown option: --%s\n", name)
+	options.printUsage()
+	os.Exit(1)
+	return ""
+}
+
+// parseCount parses the non-negative integer value of a long option.
+func parseCount(name string, value string) int {
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		fmt.Printf("Invalid value for --%s: %q (expected a non-negative number)\n", name, value)
+		os.Exit(1)
+	}
+	return count
+}
+
+// parseSink parses the PATH[:FORMAT[:color]] value of --sink. The format
+// and color fields are recognised from the end, so PATH may contain colons.
+func parseSink(value string) Sink {
+	sink := Sink{Format: "text"}
+	fields := strings.Split(value, ":")
+	if len(fields) > 1 && fields[len(fields)-1] == "color" {
+		sink.Color = true
+		fields = fields[:len(fields)-1]
+	}
+	if last := fields[len(fields)-1]; len(fields) > 1 && (last == "text" || last == "json" || last == "csv") {
+		sink.Format = last
+		fields = fields[:len(fields)-1]
+	}
+	sink.Path = strings.Join(fields, ":")
+	if sink.Path == "" {
+		fmt.Printf("Invalid value for --sink: %q (use PATH[:text|json|csv[:color]])\n", value)
+		os.Exit(1)
+	}
+	if sink.Color && sink.Format != "text" {
+		fmt.Printf("Invalid value for --sink: %q (only text sinks are colored)\n", value)
+		os.Exit(1)
+	}
+	return sink
+}
+
+// ParseColumns parses the comma separated LIST of --columns, which names
+// some of LongColumns, and returns them in the order they are printed.
+func ParseColumns(value string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, column := range strings.Split(value, ",") {
+		column = strings.TrimSpace(column)
+		known := false
+		for _, longColumn := range LongColumns {
+			known = known || column == longColumn
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q (use %s)", column, strings.Join(LongColumns, ", "))
+		}
+		selected[column] = true
+	}
+	var columns []string
+	for _, column := range LongColumns {
+		if selected[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// SetSort selects the sort KEY of --sort.
+func (o *Options) SetSort(key string) {
+	o.TimeSort, o.SizeSort, o.NoSort, o.VersionSort = key == "time", key == "size", key == "none", key == "version"
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix
+// (powers of 1024), e.g. "512M".
+func parseSize(name string, value string) int64 {
+	digits, multiplier := value, int64(1)
+	if length := len(value); length > 0 {
+		switch value[length-1] {
+		case 'K', 'k':
+			multiplier = 1 << 10
+		case 'M', 'm':
+			multiplier = 1 << 20
+		case 'G', 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			digits = value[:length-1]
+		}
+	}
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size <= 0 {
+		fmt.Printf("Invalid value for --%s: %q (expected a size such as 100M)\n", name, value)
+		os.Exit(1)
+	}
+	return size * multiplier
+}
+
 // ToMap converts Options to a map for compatibility with other functions.
 func (o Options) ToMap() map[string]bool {
 		return map[string]bool{
@@ -72,19 +317,74 @@ func (o Options) ToMap() map[string]bool {
 		"R": o.Recursive,
 		"a": o.ShowAll,
 		"t": o.TimeSort,
+		"S": o.SizeSort,
+		"U": o.NoSort,
+		"v": o.VersionSort,
 		"r": o.Reverse,
+		"d": o.Directory,
+		"L": o.Dereference,
+		"link-chain": o.LinkChain,
+		"resolve":    o.ResolveLinks,
+		"count":      o.Count != "",
+		"column-permissions": o.HasColumn("permissions"),
+		"column-links":       o.HasColumn("links"),
+		"column-owner":       o.HasColumn("owner"),
+		"column-group":       o.HasColumn("group"),
+		"column-size":        o.HasColumn("size"),
+		"column-time":        o.HasColumn("time"),
+	}
+}
+
+// HasColumn reports whether the long format shows column, one of
+// LongColumns.
+func (o Options) HasColumn(column string) bool {
+	if o.Columns == nil {
+		return true
+	}
+	for _, selected := range o.Columns {
+		if selected == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Colorless reports whether names are rendered without ANSI colors: for
+// NUL-terminated output meant for tools, and when no destination keeps
+// colors. Destinations without colors strip them from the rendered text.
+func (o Options) Colorless() bool {
+	if o.Zero {
+		return true
+	}
+	if o.TerminalColor() {
+		return false
+	}
+	for _, sink := range o.Sinks {
+		if sink.Color {
+			return false
+		}
 	}
+	return true
 }
 
-// printUsage prints a help message describing how to use the command.
-func printUsage() {
-	fmt.Println("Usage: myls [options] [path...]")
-	fmt.Println("Options:")
-	fmt.Println("  -l   Use long listing format")
-	fmt.Println("  -R   List subdirectories recursively")
-	fmt.Println("  -a   Include directory entries whose names begin with a dot (.)")
-	fmt.Println("  -t   Sort by modification time, newest first")
-	fmt.Println("  -r   Reverse order while sorting")
-	fmt.Println("  -c   Capture output to file")
-	fmt.Println("  -h   Display this help and exit")
+// TerminalColor reports whether the listing written to stdout is colored:
+// by default and with --color=always, never with --color=never, and with
+// --color=auto only when stdout is a terminal.
+func (o Options) TerminalColor() bool {
+	switch o.Color {
+	case "never":
+		return false
+	case "auto":
+		stdoutInfo, err := os.Stdout.Stat()
+		return err == nil && stdoutInfo.Mode()&os.ModeCharDevice != 0
+	}
+	return true
+}
+
+// LineTerminator returns the string ending each path in --flat output.
+func (o Options) LineTerminator() string {
+	if o.Zero {
+		return "\x00"
+	}
+	return "\n"
 }
@@ -0,0 +1,268 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// helpColumn is the column --help starts the option summaries at.
+const helpColumn = 32
+
+// examples are listed by --help and the man page.
+var examples = []struct {
+	command     string
+	description string
+}{
+	{"myls -l docs", "List docs in long format."},
+	{"myls -Ra --hide='*.tmp' src", "List src and everything below it, dot files included, except the .tmp files."},
+	{"myls --flat --zero src | xargs -0 grep -l TODO", "Hand every path below src to another tool."},
+	{"myls --top=10 -l /var/log", "Show the ten largest files below /var/log."},
+	{"myls --usage=owner --usage-format=csv /home", "Count the files and bytes of each owner below /home, as CSV."},
+	{"myls -R --output=listing-{date}.txt.gz --rotate --keep=7 /srv", "Keep a week of compressed listings of /srv."},
+	{"myls -R --sink=entries.json:json .", "Also record every listed entry as JSON."},
+	{"myls --profile=audit /etc", "List /etc with the options of [profile.audit] of the configuration file."},
+	{"myls tree -d --prune=.git src", "Show the directories below src as a tree, without descending into .git."},
+	{"myls diff --content release-1 release-2", "Show what changed between two copies of a tree."},
+}
+
+// printUsage prints the subcommands and the options of the table grouped
+// by category, with their defaults, followed by examples.
+func printUsage() {
+	fmt.Println("Usage: myls [options] [path...]")
+	fmt.Println("   or: myls COMMAND [options] [operand...]")
+	fmt.Println("List the paths (the current directory by default): directories by their contents, files by their names.")
+	fmt.Println("\nCommands:")
+	for _, command := range commandTable {
+		fmt.Printf("  %-*s%s\n", helpColumn-2, command.Name, command.Help)
+	}
+	for _, category := range categories {
+		fmt.Printf("\n%s:\n", category)
+		for _, option := range optionTable {
+			if option.Category == category {
+				printOptionLine(option)
+			}
+		}
+	}
+	fmt.Println()
+	fmt.Println("--no-OPTION undoes an option given earlier, e.g. in the configuration file")
+	fmt.Println("(~/.config/myls/config.toml) or in MYLS_OPTIONS. myls --help=OPTION shows the")
+	fmt.Println("details of an option, myls COMMAND --help the options of a command and")
+	fmt.Println("myls --man prints the manual page.")
+	fmt.Println()
+	fmt.Println("Examples:")
+	for _, example := range examples {
+		fmt.Printf("  %s\n      %s\n", example.command, example.description)
+	}
+}
+
+// printCommandUsage prints the synopsis of a subcommand, what it does and
+// the options it takes.
+func printCommandUsage(command *Command) {
+	fmt.Printf("Usage: myls %s [options] %s\n", command.Name, command.Operands)
+	fmt.Println(command.Detail)
+	fmt.Println("\nOptions:")
+	for _, option := range command.Table() {
+		printOptionLine(option)
+	}
+	fmt.Println()
+	fmt.Printf("myls %s --help=OPTION shows the details of an option.\n", command.Name)
+}
+
+// printOptionLine prints the --help line of an option: its syntax and its
+// summary, with its default.
+func printOptionLine(option Option) {
+	syntax := "  " + option.syntax(plain, plain)
+	if option.Short == 0 {
+		syntax = "      " + option.syntax(plain, plain)
+	}
+	summary := option.Help
+	if option.Default != "" {
+		summary += " (default: " + option.Default + ")"
+	}
+	if len(syntax) >= helpColumn {
+		fmt.Println(syntax)
+		syntax = ""
+	}
+	fmt.Printf("%-*s%s\n", helpColumn, syntax, summary)
+}
+
+// printOptionHelp prints the details of the option of the scope named by
+// name, which may be given as "sort", "--sort", "-t" or "--no-hide".
+func printOptionHelp(name string, options scope) {
+	name = strings.TrimLeft(name, "-")
+	var option *Option
+	if len(name) == 1 {
+		option = options.short(rune(name[0]))
+	} else if option = options.long(name); option == nil {
+		if negated, ok := strings.CutPrefix(name, "no-"); ok {
+			option = options.long(negated)
+		}
+	}
+	if option == nil {
+		fmt.Printf("Unknown option: %s\n", name)
+		fmt.Printf("Try '%s --help' for the list of options.\n", options.program())
+		os.Exit(1)
+	}
+
+	fmt.Println(option.syntax(plain, plain))
+	fmt.Printf("    %s\n", option.description())
+	if option.Default != "" {
+		fmt.Printf("    Default: %s.\n", option.Default)
+	}
+	if option.Negatable() {
+		fmt.Printf("    Undone by --no-%s.\n", option.Name)
+	}
+}
+
+// printManPage prints the manual page in roff format.
+func printManPage() {
+	fmt.Println(`.TH MYLS 1 "" "my-ls" "User Commands"`)
+	fmt.Println(".SH NAME")
+	fmt.Println(`myls \- list directory contents`)
+	fmt.Println(".SH SYNOPSIS")
+	fmt.Println(".B myls")
+	fmt.Println(`[\fIoptions\fR] [\fIpath\fR...]`)
+	fmt.Println(".br")
+	fmt.Println(".B myls")
+	fmt.Println(`\fIcommand\fR [\fIoptions\fR] [\fIoperand\fR...]`)
+	fmt.Println(".SH DESCRIPTION")
+	fmt.Println("List the paths, the current directory by default: directories by their contents, files by their names.")
+	fmt.Println("Every option that switches something on or adds to a list is undone by")
+	fmt.Println(`.BR \-\-no\- \fIOPTION\fR.`)
+	fmt.Println(".PP")
+	fmt.Println(roffEscape("A first argument naming a command (see COMMANDS) runs that command instead, unless a file of that name exists in the current directory: ./NAME or -- NAME always lists the file."))
+	fmt.Println(".SH OPTIONS")
+	for _, category := range categories {
+		fmt.Printf(".SS %s\n", roffEscape(category))
+		for _, option := range optionTable {
+			if option.Category != category {
+				continue
+			}
+			fmt.Println(".TP")
+			fmt.Println(option.syntax(roffBold, roffItalic))
+			fmt.Println(roffEscape(option.description()))
+			if option.Default != "" {
+				fmt.Printf("Default: %s.\n", roffEscape(option.Default))
+			}
+		}
+	}
+	fmt.Println(".SH COMMANDS")
+	for _, command := range commandTable {
+		fmt.Printf(".SS myls %s [options] %s\n", command.Name, roffEscape(command.Operands))
+		fmt.Println(roffEscape(command.Detail))
+		for _, option := range command.Options {
+			fmt.Println(".TP")
+			fmt.Println(option.syntax(roffBold, roffItalic))
+			fmt.Println(roffEscape(option.description()))
+			if option.Default != "" {
+				fmt.Printf("Default: %s.\n", roffEscape(option.Default))
+			}
+		}
+		var shared []string
+		for _, option := range command.Table()[len(command.Options):] {
+			var names []string
+			if option.Short != 0 {
+				names = append(names, "-"+string(option.Short))
+			}
+			if option.Name != "" {
+				names = append(names, "--"+option.Name)
+			}
+			shared = append(shared, strings.Join(names, ", "))
+		}
+		fmt.Println(".PP")
+		fmt.Printf("It also takes these options of the listing: %s.\n", roffEscape(strings.Join(shared, "; ")))
+	}
+	fmt.Println(".SH ENVIRONMENT")
+	fmt.Println(".TP")
+	fmt.Println(".B MYLS_OPTIONS")
+	fmt.Println(roffEscape("Default options, written as on the command line. They override the configuration file and are overridden by the command line."))
+	fmt.Println(".TP")
+	fmt.Println(".B PAGER")
+	fmt.Println(roffEscape("The pager of --pager, less -R when unset."))
+	fmt.Println(".TP")
+	fmt.Println(".B XDG_CONFIG_HOME")
+	fmt.Println(roffEscape("The directory holding myls/config.toml, ~/.config when unset."))
+	fmt.Println(".SH FILES")
+	fmt.Println(".TP")
+	fmt.Println(`.I ~/.config/myls/config.toml`)
+	fmt.Println(roffEscape("Default options as \"option = value\" lines keyed by long option names, and [profile.NAME] tables selected with --profile=NAME."))
+	fmt.Println(".TP")
+	fmt.Println(`.I ~/.config/myls/trusted`)
+	fmt.Println(roffEscape("The .mylsrc files trusted with --trust-dirconfig, with a hash of their content."))
+	fmt.Println(".TP")
+	fmt.Println(`.I .mylsrc`)
+	fmt.Println(roffEscape("The sort, hide and columns preferences of the directory holding it (see --dirconfig)."))
+	fmt.Println(".SH EXIT STATUS")
+	fmt.Println(roffEscape("0 if OK, 1 for minor problems (e.g. a subdirectory cannot be read during -R), 2 for serious problems (e.g. a command line argument cannot be accessed)."))
+	fmt.Println(".SH EXAMPLES")
+	for _, example := range examples {
+		fmt.Println(".TP")
+		fmt.Printf(".B %s\n", roffEscape(example.command))
+		fmt.Println(roffEscape(example.description))
+	}
+}
+
+// syntax returns how the option is written, e.g. "-I, --ignore=PATTERN" or
+// "--count[=immediate|recursive]", with its names rendered by name and its
+// value by value. Choices are spelled out in place of the placeholder.
+func (o *Option) syntax(name func(string) string, value func(string) string) string {
+	var forms []string
+	if o.Short != 0 {
+		forms = append(forms, name("-"+string(o.Short)))
+	}
+	if o.Name != "" {
+		form := name("--" + o.Name)
+		placeholder := value(o.Value)
+		if len(o.Choices) > 0 {
+			var choices []string
+			for _, choice := range o.Choices {
+				choices = append(choices, value(choice))
+			}
+			placeholder = strings.Join(choices, "|")
+		}
+		switch {
+		case o.Value != "" && o.Optional:
+			form += "[=" + placeholder + "]"
+		case o.Value != "":
+			form += "=" + placeholder
+		}
+		forms = append(forms, form)
+	}
+	return strings.Join(forms, ", ")
+}
+
+// description returns the detail of the option, or its summary as a sentence.
+func (o *Option) description() string {
+	if o.Detail != "" {
+		return o.Detail
+	}
+	return o.Help + "."
+}
+
+// plain renders text as it is.
+func plain(text string) string {
+	return text
+}
+
+// roffBold renders text in bold in a man page.
+func roffBold(text string) string {
+	return `\fB` + roffEscape(text) + `\fR`
+}
+
+// roffItalic renders text in italics in a man page.
+func roffItalic(text string) string {
+	return `\fI` + roffEscape(text) + `\fR`
+}
+
+// roffEscape escapes the characters roff would interpret: backslashes,
+// hyphens (which would otherwise not be minus signs in option names) and
+// a leading period or quote, which would start a request.
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
@@ -0,0 +1,379 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Option describes one command line option: its names, the value it
+// takes and how it changes Options. The same table serves the command
+// line, the configuration file (whose keys are the long names) and
+// MYLS_OPTIONS.
+type Option struct {
+	Name     string   // Long name (--name); "" for a short-only option.
+	Short    rune     // Single-letter form (-x); 0 when there is none.
+	Value    string   // Placeholder of the value, e.g. "N"; "" when it takes none.
+	Optional bool     // The value may be left out (--count, --du, ...).
+	Choices  []string // The accepted values, when they are a fixed set.
+	File     bool     // The value names a file, which shells complete.
+	Category string   // Heading --help and the man page list it under.
+	Help     string   // One line summary for --help.
+	Detail   string   // Longer description for --help=NAME and the man page, "" when Help says it all.
+	Default  string   // What applies when the option is not given, "" when there is nothing to say.
+
+	apply func(opts *Options, value string)
+	// negate undoes the option for --no-NAME, nil when it cannot be negated.
+	negate func(opts *Options)
+}
+
+// Table returns the table of every option, in the order --help lists them.
+func Table() []Option {
+	return optionTable
+}
+
+// Lookup returns the option with the given long name, or nil.
+func Lookup(name string) *Option {
+	for index := range optionTable {
+		if name != "" && optionTable[index].Name == name {
+			return &optionTable[index]
+		}
+	}
+	return nil
+}
+
+// lookupShort returns the option with the given single-letter form, or nil.
+func lookupShort(short rune) *Option {
+	for index := range optionTable {
+		if optionTable[index].Short == short {
+			return &optionTable[index]
+		}
+	}
+	return nil
+}
+
+// key returns the name CommandLine records the option under.
+func (o *Option) key() string {
+	if o.Name == "" {
+		return string(o.Short)
+	}
+	return o.Name
+}
+
+// Negatable reports whether --no-NAME undoes the option.
+func (o *Option) Negatable() bool {
+	return o.negate != nil
+}
+
+// checkChoice exits with an error when value is not one of the choices of
+// the option. An optional value may also be left out.
+func (o *Option) checkChoice(value string) {
+	if len(o.Choices) == 0 || (o.Optional && value == "") {
+		return
+	}
+	for _, choice := range o.Choices {
+		if value == choice {
+			return
+		}
+	}
+	choices := strings.Join(o.Choices[:len(o.Choices)-1], ", ") + " or " + o.Choices[len(o.Choices)-1]
+	fmt.Printf("Invalid value for --%s: %q (use %s)\n", o.Name, value, choices)
+	os.Exit(1)
+}
+
+// switchOption returns an option without a value that sets the boolean
+// field returns, and clears it for --no-NAME.
+func switchOption(name string, short rune, field func(opts *Options) *bool) Option {
+	return Option{
+		Name:   name,
+		Short:  short,
+		apply:  func(opts *Options, value string) { *field(opts) = true },
+		negate: func(opts *Options) { *field(opts) = false },
+	}
+}
+
+// patternOption returns an option collecting shell patterns into the list
+// field returns; --no-NAME drops the patterns given so far.
+func patternOption(name string, short rune, field func(opts *Options) *[]string) Option {
+	return Option{
+		Name:  name,
+		Short: short,
+		Value: "PATTERN",
+		apply: func(opts *Options, value string) {
+			if value == "" {
+				fmt.Printf("Option --%s requires a pattern\n", name)
+				os.Exit(1)
+			}
+			*field(opts) = append(*field(opts), value)
+		},
+		negate: func(opts *Options) { *field(opts) = nil },
+	}
+}
+
+// choiceOption returns an option storing one of choices in the field
+// returns; an optional value defaults to the first choice.
+func choiceOption(name string, optional bool, choices []string, field func(opts *Options) *string) Option {
+	return Option{
+		Name:     name,
+		Value:    strings.ToUpper(strings.ReplaceAll(name, "-", "_")),
+		Optional: optional,
+		Choices:  choices,
+		apply: func(opts *Options, value string) {
+			if value == "" {
+				value = choices[0]
+			}
+			*field(opts) = value
+		},
+	}
+}
+
+// The categories options are listed under by --help and the man page, in
+// the order they are listed.
+const (
+	selection     = "Selecting entries"
+	sorting       = "Sorting"
+	longFormat    = "Long format"
+	recursion     = "Recursion"
+	reports       = "Reports"
+	output        = "Output"
+	configuration = "Configuration"
+	information   = "Help"
+)
+
+var categories = []string{selection, sorting, longFormat, recursion, reports, output, configuration, information}
+
+// optionTable lists every option.
+var optionTable = []Option{
+	describe(switchOption("long", 'l', func(o *Options) *bool { return &o.Long }),
+		longFormat, "Use long listing format",
+		"Show the permissions, number of links, owner, group, size and modification time of each entry, after a total of the blocks the directory uses."),
+	describe(switchOption("recursive", 'R', func(o *Options) *bool { return &o.Recursive }),
+		recursion, "List subdirectories recursively",
+		"List every directory below the listed ones, each in its own \"dir:\" section."),
+	describe(switchOption("all", 'a', func(o *Options) *bool { return &o.ShowAll }),
+		selection, "Include directory entries whose names begin with a dot (.)",
+		"Include the entries whose names begin with a dot, . and .. among them, and the ones --hide would leave out."),
+	describe(Option{Short: 't', apply: func(o *Options, value string) { o.SetSort("time") }},
+		sorting, "Sort by modification time, newest first", ""),
+	describe(switchOption("reverse", 'r', func(o *Options) *bool { return &o.Reverse }),
+		sorting, "Reverse order while sorting",
+		"Reverse the order of the listing, and of the --top and --usage rows."),
+	describe(Option{Short: 'S', apply: func(o *Options, value string) { o.SetSort("size") }},
+		sorting, "Sort by size, largest first", ""),
+	describe(Option{Short: 'U', apply: func(o *Options, value string) { o.SetSort("none") }},
+		sorting, "Do not sort; list entries in directory order", ""),
+	describe(Option{Short: 'v', apply: func(o *Options, value string) { o.SetSort("version") }},
+		sorting, "Natural sort of (version) numbers within names",
+		"Compare the runs of digits within names as numbers, so v1.9 comes before v1.10."),
+	withDefault(describe(Option{
+		Name: "sort", Value: "KEY", Choices: []string{"name", "time", "size", "version", "none"},
+		apply: func(o *Options, value string) { o.SetSort(value) },
+	}, sorting, "Sort by the given key",
+		"Sort by name, modification time (-t), size (-S), version (-v) or not at all (-U)."), "name"),
+	describe(switchOption("capture", 'c', func(o *Options) *bool { return &o.Capture }),
+		output, "Capture output to a file (output.txt unless --output is given)",
+		"Write the listing to a capture file as well as to stdout. The capture file is written atomically and never appears in the listing it records."),
+	describe(Option{
+		Name: "output", Value: "FILE", File: true,
+		apply: func(o *Options, value string) {
+			if value == "" {
+				fmt.Println("Option --output requires a file name")
+				os.Exit(1)
+			}
+			o.OutputPath = value
+			o.Capture = value != "-"
+		},
+		negate: func(o *Options) { o.OutputPath, o.Capture = "", false },
+	}, output, "Capture output to FILE ({date}, {time} and {host} are expanded; - for stdout only)",
+		"Capture the listing to FILE instead of output.txt, creating missing parent directories. {date}, {time} and {host} in the name are expanded (e.g. listing-{date}-{host}.txt); - writes to stdout only."),
+	describe(switchOption("append", 0, func(o *Options) *bool { return &o.Append }),
+		output, "Append to the capture file instead of replacing it", ""),
+	describe(switchOption("no-clobber", 0, func(o *Options) *bool { return &o.NoClobber }),
+		output, "Do not overwrite an existing capture file",
+		"Fail (exit status 2) instead of overwriting an existing capture file."),
+	withDefault(describe(Option{
+		Name: "compress", Value: "METHOD", Choices: []string{"gzip", "zstd", "none"},
+		apply:  func(o *Options, value string) { o.Compress = value },
+		negate: func(o *Options) { o.Compress = "none" },
+	}, output, "Compress capture and sink files",
+		"Compress capture and sink files. zstd compression runs the zstd program."), "by the .gz or .zst extension"),
+	describe(switchOption("rotate", 0, func(o *Options) *bool { return &o.Rotate }),
+		output, "Keep the previous capture file as FILE.1, FILE.2, ... instead of replacing it",
+		"Keep the previous capture file as a numbered copy instead of replacing it (listing.gz becomes listing.1.gz, listing.1.gz becomes listing.2.gz, ...)."),
+	describe(Option{Name: "rotate-size", Value: "SIZE", apply: func(o *Options, value string) { o.RotateSize = parseSize("rotate-size", value) }},
+		output, "Start a new capture file after SIZE bytes of listing (K, M and G suffixes)",
+		"Start a new capture file once SIZE bytes of listing (before compression; K, M and G suffixes) were written to the current one, rotating the previous ones. Lines are never split between files."),
+	describe(Option{Name: "keep", Value: "N", apply: func(o *Options, value string) { o.Keep = parseCount("keep", value) }},
+		output, "Keep at most N rotated capture files",
+		"Keep at most N rotated capture files, removing older ones. --rotate, --rotate-size and --keep cannot be combined with --append."),
+	withDefault(describe(Option{
+		Name: "color", Value: "WHEN", Optional: true, Choices: []string{"auto", "always", "never"},
+		apply: func(o *Options, value string) {
+			if value == "" {
+				value = "always"
+			}
+			o.Color = value
+		},
+		negate: func(o *Options) { o.Color = "never" },
+	}, output, "Color the listing on stdout",
+		"Color the listing on stdout: always, never, or only when stdout is a terminal (auto). Capture files are never colored; --color alone means always."), "always"),
+	describe(switchOption("pager", 0, func(o *Options) *bool { return &o.Pager }),
+		output, "Show a listing taller than the terminal through $PAGER",
+		"When stdout is a terminal and the listing is taller than it, show the listing through $PAGER (less -R when unset, which keeps the colors). A listing that fits is printed directly; when the pager is missing the listing goes to stdout."),
+	describe(Option{
+		Name: "sink", Value: "PATH[:FORMAT[:color]]", File: true,
+		apply:  func(o *Options, value string) { o.Sinks = append(o.Sinks, parseSink(value)) },
+		negate: func(o *Options) { o.Sinks = nil },
+	}, output, "Also write the listing to PATH (- for stdout) as text, json or csv; repeatable",
+		"Also write the listing to PATH (- replaces the text listing on stdout). text sinks get the listing as printed, colored only with :color; json sinks get one JSON object per listed entry (path, name, type, mode, links, owner, group, size, modified) and csv sinks the same fields with a header row. --output's name templates, --append and --no-clobber apply."),
+	describe(switchOption("directory", 'd', func(o *Options) *bool { return &o.Directory }),
+		selection, "List directories themselves, not their contents", ""),
+	describe(switchOption("dereference", 'L', func(o *Options) *bool { return &o.Dereference }),
+		selection, "Show information for the file a symbolic link references",
+		"Show information for the file a symbolic link references, also while recursing."),
+	describe(switchOption("dereference-command-line", 'H', func(o *Options) *bool { return &o.DereferenceCommandLine }),
+		selection, "Follow symbolic links listed on the command line", ""),
+	describe(switchOption("dereference-command-line-symlink-to-dir", 0, func(o *Options) *bool { return &o.DereferenceDirArgs }),
+		selection, "Follow command line symbolic links that point to a directory",
+		"Follow command line symbolic links to directories, which is the default unless -l or -d is given."),
+	describe(Option{Name: "help", Short: 'h', Value: "OPTION", Optional: true},
+		information, "Display this help, or the details of OPTION, and exit", ""),
+	describe(Option{Name: "man"},
+		information, "Print the manual page (roff) and exit",
+		"Print the manual page in roff format, e.g. for myls --man | man -l -."),
+	describe(choiceOption("completion", false, []string{"bash", "zsh", "fish"}, func(o *Options) *string { return &o.Completion }),
+		information, "Print a shell completion script and exit",
+		"Print a completion script for options, their values and paths, generated from the same option table as the parser: source <(myls --completion=bash), source <(myls --completion=zsh) or myls --completion=fish | source."),
+	// The configuration options are read by the config package before the
+	// arguments are parsed.
+	describe(Option{Name: "no-config", apply: func(o *Options, value string) {}},
+		configuration, "Do not read the configuration file", ""),
+	describe(Option{Name: "profile", Value: "NAME", apply: func(o *Options, value string) {}},
+		configuration, "Apply the options of [profile.NAME] from the configuration file", ""),
+	describe(patternOption("ignore", 'I', func(o *Options) *[]string { return &o.Ignore }),
+		selection, "Do not list entries matching the shell PATTERN; repeatable", ""),
+	describe(patternOption("hide", 0, func(o *Options) *[]string { return &o.Hide }),
+		selection, "Do not list entries matching PATTERN unless -a is given; repeatable", ""),
+	describe(withNegate(choiceOption("count", true, []string{"immediate", "recursive"}, func(o *Options) *string { return &o.Count }),
+		func(o *Options) { o.Count = "" }),
+		longFormat, "Show how many entries each directory holds",
+		"In long format, and after each directory of myls tree, show how many entries each directory holds, or with recursive how many files and directories its whole tree holds (e.g. 12f/3d). The -a, --ignore and --hide rules decide what counts."),
+	describe(withNegate(choiceOption("stats", true, []string{"text", "json"}, func(o *Options) *string { return &o.Stats }),
+		func(o *Options) { o.Stats, o.StatsOnly = "", false }),
+		reports, "Print a summary of the listed trees after the listing",
+		"After the listing, print a summary of the listed trees: files, directories and links by type, total and average size, size and age histograms, breakdown by extension and the deepest path."),
+	describe(Option{
+		Name: "top", Value: "N",
+		apply:  func(o *Options, value string) { o.Top = parseCount("top", value) },
+		negate: func(o *Options) { o.Top = 0 },
+	}, reports, "Print the N largest files below the listed directories, with full paths",
+		"Instead of the listing, print the N largest files below the listed directories with full paths (largest first, -r for the reverse). Memory use stays constant whatever the size of the tree. Works with -l, --absolute and --zero."),
+	withDefault(describe(choiceOption("by", false, []string{"size", "mtime", "atime"}, func(o *Options) *string { return &o.TopBy }),
+		reports, "Rank --top by size, modification time or access time", ""), "size"),
+	describe(withNegate(choiceOption("usage", false, []string{"owner", "group"}, func(o *Options) *string { return &o.Usage }),
+		func(o *Options) { o.Usage = "" }),
+		reports, "Print the files and bytes used by each owner or group below the operands",
+		"Instead of the listing, print how many files and bytes (apparent and allocated) each owner or group uses below the operands. Hard-linked files are counted once."),
+	withDefault(describe(choiceOption("usage-format", false, []string{"table", "csv", "json"}, func(o *Options) *string { return &o.UsageFormat }),
+		reports, "Output format of --usage", ""), "table"),
+	withDefault(describe(choiceOption("usage-sort", false, []string{"bytes", "allocated", "files", "name"}, func(o *Options) *string { return &o.UsageSort }),
+		reports, "Order of the --usage rows, largest first", "Order of the --usage rows, largest first (-r for the reverse)."), "bytes"),
+	describe(Option{
+		Name: "stats-only",
+		apply: func(o *Options, value string) {
+			o.StatsOnly = true
+			if o.Stats == "" {
+				o.Stats = "text"
+			}
+		},
+		negate: func(o *Options) { o.StatsOnly = false },
+	}, reports, "Print only the --stats summary", ""),
+	describe(switchOption("one-file-system", 'x', func(o *Options) *bool { return &o.OneFileSystem }),
+		recursion, "Do not descend into directories on other file systems", ""),
+	withDefault(describe(Option{
+		Name: "max-depth", Value: "N",
+		apply:  func(o *Options, value string) { o.MaxDepth = parseCount("max-depth", value) },
+		negate: func(o *Options) { o.MaxDepth = -1 },
+	}, recursion, "Do not descend more than N levels below each listed directory", ""), "unlimited"),
+	describe(Option{
+		Name: "min-depth", Value: "N",
+		apply:  func(o *Options, value string) { o.MinDepth = parseCount("min-depth", value) },
+		negate: func(o *Options) { o.MinDepth = 0 },
+	}, recursion, "Only print directories at least N levels below each listed directory", ""),
+	describe(patternOption("prune", 0, func(o *Options) *[]string { return &o.Prune }),
+		recursion, "List matching directories but do not descend into them; repeatable",
+		"List the directories matching PATTERN (e.g. node_modules, .git) but do not descend into them. Patterns with a slash match the whole path."),
+	describe(withNegate(choiceOption("du", true, []string{"apparent", "allocated"}, func(o *Options) *string { return &o.DiskUsage }),
+		func(o *Options) { o.DiskUsage = "" }),
+		longFormat, "Show the total size of each directory's tree in the size column",
+		"Show the total size of each listed directory's tree in the size column (apparent by default). Hard links are counted once within each tree, -x keeps the count on one file system, and -S sorts directories by their totals."),
+	describe(switchOption("follow", 0, func(o *Options) *bool { return &o.Follow }),
+		recursion, "Descend into symbolic links to directories while recursing",
+		"While recursing, descend into symbolic links to directories. Directories already being listed are reported instead of looping."),
+	withDefault(describe(choiceOption("traversal", false, []string{"depth", "breadth", "post"}, func(o *Options) *string { return &o.Traversal }),
+		recursion, "Order of the directory sections while recursing",
+		"Order of the directory sections while recursing: depth-first, breadth-first (top of the tree first) or post-order (subdirectories before their parent)."), "depth"),
+	withDefault(describe(Option{Name: "jobs", Value: "N", apply: func(o *Options, value string) { o.Jobs = parseCount("jobs", value) }},
+		recursion, "Read up to N directories in parallel while recursing",
+		"While recursing, read up to N directories in parallel (1 for strictly sequential). Output order is unchanged."), "one per CPU"),
+	describe(switchOption("flat", 0, func(o *Options) *bool { return &o.Flat }),
+		recursion, "List the whole tree with one full path per entry",
+		"List the whole tree with one full path per entry instead of \"dir:\" sections; works with -a, -t, -r, -l and the recursion options. The output is streamed a directory at a time, so entries are sorted, and -l columns aligned, within each directory rather than across the whole tree."),
+	describe(switchOption("absolute", 0, func(o *Options) *bool { return &o.Absolute }),
+		recursion, "With --flat, print absolute paths", ""),
+	describe(switchOption("tilde", 0, func(o *Options) *bool { return &o.Tilde }),
+		recursion, "With --flat, print absolute paths with the home directory as ~", ""),
+	describe(switchOption("zero", 0, func(o *Options) *bool { return &o.Zero }),
+		recursion, "With --flat, end each path with NUL instead of newline",
+		"With --flat, end each path with a NUL byte (for xargs -0); colors are turned off."),
+	describe(switchOption("link-chain", 0, func(o *Options) *bool { return &o.LinkChain }),
+		longFormat, "Show every hop of a symbolic link chain (a -> b -> c)", ""),
+	describe(switchOption("resolve", 0, func(o *Options) *bool { return &o.ResolveLinks }),
+		longFormat, "Show the canonical absolute path a symbolic link resolves to", ""),
+	withDefault(describe(choiceOption("errors", false, []string{"text", "json"}, func(o *Options) *string { return &o.ErrorFormat }),
+		output, "Write diagnostics as GNU style text or JSON lines",
+		"Write diagnostics to stderr as GNU style text or as one JSON object per line."), "text"),
+	withDefault(describe(Option{
+		Name: "ambiguous-width", Value: "WIDTH", Choices: []string{"narrow", "wide"},
+		apply: func(o *Options, value string) { o.AmbiguousWide = value == "wide" },
+	}, longFormat, "Width of East Asian ambiguous characters when aligning columns", ""), "narrow"),
+	withDefault(describe(Option{
+		Name: "columns", Value: "LIST",
+		apply: func(o *Options, value string) {
+			columns, err := ParseColumns(value)
+			if err != nil {
+				fmt.Printf("Invalid value for --columns: %q (%v)\n", value, err)
+				os.Exit(1)
+			}
+			o.Columns = columns
+		},
+		negate: func(o *Options) { o.Columns = nil },
+	}, longFormat, "Long format columns to show: permissions, links, owner, group, size, time",
+		"Long format columns to show, a comma separated list of permissions, links, owner, group, size and time. The name is always shown."), "all of them"),
+	withDefault(describe(withNegate(choiceOption("dirconfig", true, []string{"here", "ancestors"}, func(o *Options) *string { return &o.DirConfig }),
+		func(o *Options) { o.DirConfig = "" }),
+		configuration, "Apply the .mylsrc of each listed directory, or also those of its ancestors",
+		"Apply the sort, hide and columns preferences of the trusted .mylsrc of each listed directory, and with ancestors those of the directories above it, the nearest one winning. Options given on the command line override them."), "here"),
+	describe(switchOption("trust-dirconfig", 0, func(o *Options) *bool { return &o.TrustDirConfig }),
+		configuration, "Trust the .mylsrc files this run reads, as they are now",
+		"Trust the .mylsrc files this run reads, as they are now: a .mylsrc is only used once trusted, and is ignored again when its content changes. Only taken on the command line, not from the configuration file or MYLS_OPTIONS."),
+}
+
+// withNegate returns option with negate as its --no-NAME form.
+func withNegate(option Option, negate func(opts *Options)) Option {
+	option.negate = negate
+	return option
+}
+
+// describe returns option with its help: the category it is listed under,
+// a one line summary and, when the summary is not enough, a longer detail.
+func describe(option Option, category string, help string, detail string) Option {
+	option.Category, option.Help, option.Detail = category, help, detail
+	return option
+}
+
+// withDefault returns option documenting what applies when it is not given.
+func withDefault(option Option, defaultValue string) Option {
+	option.Default = defaultValue
+	return option
+}
@@ -5,23 +5,164 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"eles/completion"
+	"eles/config"
+	"eles/diff"
+	"eles/dirconfig"
 	"eles/display"
-	"eles/filter"
+	"eles/du"
 	"eles/flags"
 	"eles/output"
 	"eles/recursive"
-	"eles/sort"
+	"eles/stat"
+	"eles/stats"
+	"eles/status"
+	"eles/top"
+	"eles/tree"
+	"eles/usage"
 	"eles/utils"
+	"eles/width"
 )
 
+// commands maps each subcommand of flags.Commands to the function running it.
+var commands = map[string]func(options flags.Options, outputWriter io.Writer){
+	"tree": tree.Run,
+	"du":   du.Report,
+	"diff": diff.Run,
+	"stat": stat.Run,
+}
+
 // Run is the entry point called from main.go.
 func Run(arguments []string) {
-	options := flags.ParseArgs(arguments)
-	outputWriter, cleanupFunc := output.NewOutput(options.Capture)
+	if command := subcommand(arguments); command != nil {
+		runCommand(command, arguments[1:])
+	}
+	options := flags.ParseArgs(config.Defaults(arguments), arguments)
+	if options.Completion != "" {
+		completion.Print(options.Completion, os.Stdout)
+		os.Exit(0)
+	}
+	width.SetAmbiguousWide(options.AmbiguousWide)
+	status.SetFormat(options.ErrorFormat)
+	outputWriter, cleanupFunc := output.NewOutput(options)
 	RunInternal(options, outputWriter)
 	cleanupFunc()
+	os.Exit(status.ExitCode())
+}
+
+// subcommand returns the subcommand the first argument names, or nil for a
+// listing. A file of that name in the current directory is still listed,
+// as it was before subcommands existed.
+func subcommand(arguments []string) *flags.Command {
+	if len(arguments) == 0 {
+		return nil
+	}
+	command := flags.LookupCommand(arguments[0])
+	if command == nil {
+		return nil
+	}
+	if _, err := os.Lstat(arguments[0]); err == nil {
+		return nil
+	}
+	return command
+}
+
+// runCommand runs a subcommand with the arguments that follow its name,
+// its output going where the listing's would, and exits.
+func runCommand(command *flags.Command, arguments []string) {
+	options := flags.ParseCommand(command, config.Defaults(arguments), arguments)
+	width.SetAmbiguousWide(options.AmbiguousWide)
+	status.SetFormat(options.ErrorFormat)
+	outputWriter, cleanupFunc := output.NewOutput(options)
+	commands[command.Name](options, outputWriter)
+	cleanupFunc()
+	os.Exit(status.ExitCode())
+}
+
+// statOperand returns the file information used for a command line operand.
+// Symbolic links are followed with -L and -H, and by default (as in GNU ls)
+// when they point to a directory and neither -l nor -d is given.
+// A trailing slash always resolves the link, as the kernel does.
+func statOperand(operandPath string, options flags.Options) (os.FileInfo, error) {
+	linkInfo, err := os.Lstat(operandPath)
+	if err != nil || linkInfo.Mode()&os.ModeSymlink == 0 {
+		return linkInfo, err
+	}
+
+	followAll := options.Dereference || options.DereferenceCommandLine
+	followDirs := options.DereferenceDirArgs || (!options.Long && !options.Directory)
+	if !followAll && !followDirs {
+		return linkInfo, nil
+	}
+
+	targetInfo, err := os.Stat(operandPath)
+	if err != nil {
+		// A dangling link is still listed as the link itself.
+		return linkInfo, nil
+	}
+	if followAll || targetInfo.IsDir() {
+		return targetInfo, nil
+	}
+	return linkInfo, nil
+}
+
+// listFlat prints every operand and everything below the directory operands
+// as one path per line, without headers or blank lines (--flat).
+func listFlat(options flags.Options, fileArgumentPaths []string, directoryArgumentPaths []string, operandInfos map[string]os.FileInfo, outputWriter io.Writer) {
+	optionFlags := options.ToMap()
+	for _, filePath := range fileArgumentPaths {
+		baseName := filepath.Base(filePath)
+		namePrefix := strings.TrimSuffix(utils.DisplayPath(filePath, options.Absolute, options.Tilde), baseName)
+		pseudoEntry := utils.NewPseudoDirEntry(operandInfos[filePath], baseName)
+		display.DisplayFlat([]fs.DirEntry{pseudoEntry}, filepath.Dir(filePath), namePrefix, optionFlags, outputWriter, options.Colorless(), options.LineTerminator())
+	}
+	for _, directoryPath := range directoryArgumentPaths {
+		recursive.RecursiveList(directoryPath, options, outputWriter, false)
+	}
+}
+
+// listTop prints the --top largest, newest or most recently accessed files
+// found below the operands, one full path per line or in long format.
+func listTop(options flags.Options, inputPaths []string, operandInfos map[string]os.FileInfo, outputWriter io.Writer) {
+	var roots []string
+	for _, currentPath := range inputPaths {
+		if _, ok := operandInfos[currentPath]; ok {
+			roots = append(roots, currentPath)
+		}
+	}
+
+	var topEntries []fs.DirEntry
+	for _, winner := range top.Find(roots, options.Top, options.TopBy, options) {
+		displayName := utils.DisplayPath(winner.Path, options.Absolute, false)
+		topEntries = append(topEntries, utils.NewPseudoDirEntry(winner.Info, displayName))
+	}
+	if options.Reverse {
+		for i, j := 0, len(topEntries)-1; i < j; i, j = i+1, j-1 {
+			topEntries[i], topEntries[j] = topEntries[j], topEntries[i]
+		}
+	}
+	display.DisplayFlat(topEntries, "", "", options.ToMap(), outputWriter, options.Colorless(), options.LineTerminator())
+}
+
+// listUsage prints the --usage accounting of the operands per owner or group.
+func listUsage(options flags.Options, inputPaths []string, operandInfos map[string]os.FileInfo, outputWriter io.Writer) {
+	var roots []string
+	for _, currentPath := range inputPaths {
+		if _, ok := operandInfos[currentPath]; ok {
+			roots = append(roots, currentPath)
+		}
+	}
+	accounts := usage.Collect(roots, options.Usage, options)
+	usage.Sort(accounts, options.UsageSort)
+	if options.Reverse {
+		for i, j := 0, len(accounts)-1; i < j; i, j = i+1, j-1 {
+			accounts[i], accounts[j] = accounts[j], accounts[i]
+		}
+	}
+	usage.Print(accounts, options.Usage, options.UsageFormat, outputWriter)
 }
 
 // RunInternal separates file and directory arguments.
@@ -29,72 +170,102 @@ func Run(arguments []string) {
 // If the recursive flag (-R) is set, each directory is listed recursively.
 func RunInternal(options flags.Options, outputWriter io.Writer) {
 	inputPaths := options.Paths
-	optionFlags := options.ToMap()
 
 	var fileArgumentPaths []string
 	var directoryArgumentPaths []string
 
 	// Separate file and directory arguments.
+	operandInfos := make(map[string]os.FileInfo)
 	for _, currentPath := range inputPaths {
-		fileInfo, err := os.Lstat(currentPath)
+		fileInfo, err := statOperand(currentPath, options)
 		if err != nil {
-			if strings.Contains(err.Error(), "not a directory") && strings.HasSuffix(currentPath, "/") {
-				fmt.Fprintf(os.Stderr, "my-ls: cannot access '%s': Not a directory\n", currentPath)
-			} else if os.IsNotExist(err) {
-				fmt.Fprintf(os.Stderr, "my-ls: cannot access '%s': No such file or directory\n", currentPath)
-			} else if os.IsPermission(err) {
-				fmt.Fprintf(os.Stderr, "my-ls: cannot open '%s': Permission denied\n", currentPath)
-			} else {
-				fmt.Fprintf(os.Stderr, "my-ls: %v\n", err)
-			}
+			// An unusable command line argument is a serious problem (exit status 2).
+			status.ReportError(status.Serious, "cannot access", currentPath, err)
 			continue
 		}
-		if fileInfo.IsDir() {
+		operandInfos[currentPath] = fileInfo
+		// With -d directories are listed like any other file.
+		if fileInfo.IsDir() && !options.Directory {
 			directoryArgumentPaths = append(directoryArgumentPaths, currentPath)
 		} else {
 			fileArgumentPaths = append(fileArgumentPaths, currentPath)
 		}
 	}
 
+	if !options.StatsOnly {
+		if options.Top > 0 {
+			listTop(options, inputPaths, operandInfos, outputWriter)
+		} else if options.Usage != "" {
+			listUsage(options, inputPaths, operandInfos, outputWriter)
+		} else if options.Flat {
+			listFlat(options, fileArgumentPaths, directoryArgumentPaths, operandInfos, outputWriter)
+		} else {
+			listOperands(options, fileArgumentPaths, directoryArgumentPaths, operandInfos, outputWriter)
+		}
+	}
+
+	// The --stats report follows the listing, or replaces it with --stats-only.
+	if options.Stats != "" {
+		var statsRoots []string
+		for _, currentPath := range inputPaths {
+			if _, ok := operandInfos[currentPath]; ok {
+				statsRoots = append(statsRoots, currentPath)
+			}
+		}
+		if !options.StatsOnly && len(statsRoots) > 0 {
+			fmt.Fprintln(outputWriter)
+		}
+		stats.Print(stats.Collect(statsRoots, options), options.Stats, outputWriter)
+	}
+}
+
+// listOperands lists file operands first and then the contents of each
+// directory operand, recursively with -R.
+func listOperands(options flags.Options, fileArgumentPaths []string, directoryArgumentPaths []string, operandInfos map[string]os.FileInfo, outputWriter io.Writer) {
+	optionFlags := options.ToMap()
+
 	// Process file arguments first.
 	for _, filePath := range fileArgumentPaths {
-		fileInfo, _ := os.Lstat(filePath)
+		fileInfo := operandInfos[filePath]
 		if options.Long {
 			// For a single file, do not print the "total" line.
-			pseudoEntry := utils.NewPseudoDirEntry(fileInfo, filePath)
-			display.DisplayLongFormat([]fs.DirEntry{pseudoEntry}, ".", outputWriter, options.Capture, false)
+			pseudoEntries := recursive.Annotate([]fs.DirEntry{utils.NewPseudoDirEntry(fileInfo, filePath)}, ".", options, nil, nil)
+			display.DisplayLongFormat(pseudoEntries, ".", optionFlags, outputWriter, options.Colorless(), false)
 		} else {
+			display.RecordEntries([]fs.DirEntry{utils.NewPseudoDirEntry(fileInfo, filePath)}, "", outputWriter)
 			fmt.Fprintf(outputWriter, "%s\n", filePath)
 		}
 	}
 
-	// If both file and directory arguments exist, print a newline as separator.
-	if len(fileArgumentPaths) > 0 && len(directoryArgumentPaths) > 0 {
-		fmt.Fprintln(outputWriter)
-	}
-
 	// Process directory arguments.
 	// Print header (i.e. directory name + colon) if more than one directory or if files are listed above.
+	// Recursive listings always print their own headers.
+	// As in GNU ls, a blank line separates each directory from the output
+	// before it, so an operand that prints nothing (unreadable, or empty
+	// with --min-depth) adds no blank line either.
 	multipleHeaders := (len(directoryArgumentPaths) > 1) || (len(fileArgumentPaths) > 0)
-	for index, directoryPath := range directoryArgumentPaths {
-		if multipleHeaders {
-			fmt.Fprintf(outputWriter, "%s:\n", directoryPath)
-		}
+	printed := len(fileArgumentPaths) > 0
+	for _, directoryPath := range directoryArgumentPaths {
 		if options.Recursive {
 			// Recursive listing for directories.
-			recursive.RecursiveList(directoryPath, optionFlags, options.Capture, outputWriter)
-		} else {
-			directoryEntries, err := os.ReadDir(directoryPath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "my-ls: %v\n", err)
-				continue
+			if recursive.RecursiveList(directoryPath, options, outputWriter, printed) {
+				printed = true
 			}
-			directoryEntries = filter.FilterFiles(directoryEntries, optionFlags, directoryPath)
-			directoryEntries = sort.SortFiles(directoryEntries, optionFlags)
-			display.DisplayFiles(directoryEntries, directoryPath, optionFlags, outputWriter, options.Capture)
+			continue
+		}
+		directoryOptions := dirconfig.Apply(directoryPath, options)
+		directoryEntries, err := recursive.ReadDirectory(directoryPath, recursive.ShownAnnotations(directoryOptions))
+		if err != nil {
+			status.ReportError(status.Serious, "cannot open directory", directoryPath, err)
+			continue
 		}
-		if index < len(directoryArgumentPaths)-1 {
+		if printed {
 			fmt.Fprintln(outputWriter)
 		}
+		if multipleHeaders {
+			fmt.Fprintf(outputWriter, "%s:\n", directoryPath)
+		}
+		display.DisplayFiles(directoryEntries, directoryPath, directoryOptions.ToMap(), outputWriter, options.Colorless())
+		printed = true
 	}
 }
@@ -0,0 +1,135 @@
+package ls
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"eles/flags"
+)
+
+// recordingWriter is a listing destination with a structured sink that
+// keeps the recorded paths.
+type recordingWriter struct {
+	bytes.Buffer
+	paths []string
+}
+
+func (w *recordingWriter) Record(entryPath string, entry fs.DirEntry) {
+	w.paths = append(w.paths, entryPath)
+}
+
+// makeFiles creates the named files below root; names ending in / are
+// directories.
+func makeFiles(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		filePath := filepath.Join(root, name)
+		var err error
+		if name[len(name)-1] == '/' {
+			err = os.MkdirAll(filePath, 0o755)
+		} else {
+			err = os.WriteFile(filePath, []byte(name), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestSinkRecordsEachPathOnce checks that a recursive listing with -a
+// records every entry once, and not the . and .. entries that would name
+// the directories again or their parents.
+func TestSinkRecordsEachPathOnce(t *testing.T) {
+	root := t.TempDir()
+	makeFiles(t, root, "a/", "a/b/", "a/b/c/", "a/b/c/deep.txt", "a/b/file.txt", "a/.hidden", "top.txt")
+	operand := filepath.Join(root, "a")
+	want := []string{
+		filepath.Join(operand, ".hidden"),
+		filepath.Join(operand, "b"),
+		filepath.Join(operand, "b", "c"),
+		filepath.Join(operand, "b", "c", "deep.txt"),
+		filepath.Join(operand, "b", "file.txt"),
+	}
+
+	for _, arguments := range [][]string{{"-Ra"}, {"-Ra", "-l"}, {"-Ra", "--flat"}, {"-Ra", "--traversal=post"}} {
+		outputWriter := &recordingWriter{}
+		RunInternal(flags.ParseArgs(nil, append(arguments, "--color=never", operand)), outputWriter)
+		got := slices.Clone(outputWriter.paths)
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%q recorded %q, want each of %q once", arguments, outputWriter.paths, want)
+		}
+	}
+}
+
+// list runs a listing with the given arguments in directory and returns
+// its output.
+func list(t *testing.T, directory string, arguments ...string) string {
+	t.Helper()
+	t.Chdir(directory)
+	var output bytes.Buffer
+	RunInternal(flags.ParseArgs(nil, append(arguments, "--color=never")), &output)
+	return output.String()
+}
+
+// TestOperandSeparators checks that, as in GNU ls, a blank line separates
+// each operand's output from what was printed before it, and that an
+// operand that prints nothing adds no blank line.
+func TestOperandSeparators(t *testing.T) {
+	root := t.TempDir()
+	makeFiles(t, root, "empty/", "a/", "a/f", "a/s/", "a/s/x", "b/", "b/y", "file")
+
+	tests := []struct {
+		arguments []string
+		want      string
+	}{
+		{[]string{"a"}, "f  s\n"},
+		{[]string{"a", "b"}, "a:\nf  s\n\nb:\ny\n"},
+		{[]string{"empty", "b"}, "empty:\n\nb:\ny\n"},
+		{[]string{"file", "b"}, "file\n\nb:\ny\n"},
+		{[]string{"-R", "a", "b"}, "a:\nf  s\n\na/s:\nx\n\nb:\ny\n"},
+		{[]string{"-R", "file", "b"}, "file\n\nb:\ny\n"},
+		// The depth 0 sections are left out, and empty prints nothing at all.
+		{[]string{"-R", "--min-depth=1", "empty", "a"}, "a/s:\nx\n"},
+		{[]string{"-R", "--min-depth=1", "a", "empty", "a"}, "a/s:\nx\n\na/s:\nx\n"},
+		{[]string{"-R", "--min-depth=1", "b", "a"}, "a/s:\nx\n"},
+	}
+	for _, test := range tests {
+		if got := list(t, root, test.arguments...); got != test.want {
+			t.Errorf("myls %q =\n%q\nwant\n%q", test.arguments, got, test.want)
+		}
+	}
+}
+
+// TestUnreadableOperandSeparators checks that a directory operand that
+// cannot be read prints neither its header nor a blank line.
+func TestUnreadableOperandSeparators(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions do not apply to root")
+	}
+	root := t.TempDir()
+	makeFiles(t, root, "a/", "a/f", "b/", "b/y", "locked/", "file")
+	if err := os.Chmod(filepath.Join(root, "locked"), 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(root, "locked"), 0o755) })
+
+	tests := []struct {
+		arguments []string
+		want      string
+	}{
+		{[]string{"locked", "b"}, "b:\ny\n"},
+		{[]string{"a", "locked", "b"}, "a:\nf\n\nb:\ny\n"},
+		{[]string{"a", "locked"}, "a:\nf\n"},
+		{[]string{"file", "locked"}, "file\n"},
+	}
+	for _, test := range tests {
+		if got := list(t, root, test.arguments...); got != test.want {
+			t.Errorf("myls %q =\n%q\nwant\n%q", test.arguments, got, test.want)
+		}
+	}
+}
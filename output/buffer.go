@@ -0,0 +1,66 @@
+package output
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+)
+
+// bufferSize is the size of the stdout and capture file buffers.
+const bufferSize = 64 << 10
+
+// bufferedStdout collects what is written to stdout in a buffer that is
+// written out when full, before each diagnostic and on exit. It is safe
+// for concurrent use, since diagnostics are reported from worker
+// goroutines. When the reader of stdout goes away (EPIPE, e.g. when piped
+// into head), that is recorded and later output is dropped; the goroutine
+// writing the listing ends the run (see Writer.stopIfBroken), whichever
+// goroutine found the broken pipe.
+type bufferedStdout struct {
+	mutex  sync.Mutex
+	buffer *bufio.Writer
+	closed bool // The reader of stdout went away.
+}
+
+func newBufferedStdout(stdout io.Writer) *bufferedStdout {
+	return &bufferedStdout{buffer: bufio.NewWriterSize(stdout, bufferSize)}
+}
+
+func (b *bufferedStdout) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return len(p), nil
+	}
+	n, err := b.buffer.Write(p)
+	b.check(err)
+	return n, err
+}
+
+// Flush writes out the buffered output.
+func (b *bufferedStdout) Flush() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil
+	}
+	err := b.buffer.Flush()
+	b.check(err)
+	return err
+}
+
+// check records that the reader of stdout went away when err says so.
+func (b *bufferedStdout) check(err error) {
+	if err != nil && errors.Is(err, syscall.EPIPE) {
+		b.closed = true
+	}
+}
+
+// broken reports whether the reader of stdout went away.
+func (b *bufferedStdout) broken() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.closed
+}
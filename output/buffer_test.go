@@ -0,0 +1,108 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// listingRows is the number of entries of the synthetic listing, about the
+// size of a recursive listing of /usr/lib.
+const listingRows = 100000
+
+// writeLongListing writes a long format listing of listingRows entries,
+// one write per row as display does.
+func writeLongListing(w io.Writer) {
+	for index := 0; index < listingRows; index++ {
+		fmt.Fprintf(w, "-rw-r--r-- 1 user group %8d Jan  2 15:04 file-%06d.txt\n", index*37, index)
+	}
+}
+
+// writeShortListing writes the names of listingRows entries on one line,
+// a separator and a name per entry as display does.
+func writeShortListing(w io.Writer) {
+	for index := 0; index < listingRows; index++ {
+		if index > 0 {
+			fmt.Fprint(w, "  ")
+		}
+		fmt.Fprintf(w, "file-%06d.txt", index)
+	}
+	fmt.Fprintln(w)
+}
+
+// openStdout returns a stand-in for os.Stdout: an unbuffered *os.File on
+// the null device, so every write is a system call, as with os.Stdout.
+func openStdout(b *testing.B) *os.File {
+	stdout, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { stdout.Close() })
+	return stdout
+}
+
+func benchmarkDirect(b *testing.B, writeListing func(io.Writer)) {
+	stdout := openStdout(b)
+	for b.Loop() {
+		writeListing(stdout)
+	}
+}
+
+func benchmarkBuffered(b *testing.B, writeListing func(io.Writer)) {
+	stdout := openStdout(b)
+	for b.Loop() {
+		buffered := newBufferedStdout(stdout)
+		writeListing(buffered)
+		if err := buffered.Flush(); err != nil || buffered.broken() {
+			b.Fatal("stdout broken", err)
+		}
+	}
+}
+
+func BenchmarkLongListingDirect(b *testing.B)    { benchmarkDirect(b, writeLongListing) }
+func BenchmarkLongListingBuffered(b *testing.B)  { benchmarkBuffered(b, writeLongListing) }
+func BenchmarkShortListingDirect(b *testing.B)   { benchmarkDirect(b, writeShortListing) }
+func BenchmarkShortListingBuffered(b *testing.B) { benchmarkBuffered(b, writeShortListing) }
+
+// closedPipe is a stdout whose reader went away.
+type closedPipe struct{}
+
+func (closedPipe) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}
+}
+
+// TestBrokenStdout checks that a broken pipe found by any goroutine is only
+// recorded, for the goroutine writing the listing to act on, and that the
+// output that follows is dropped.
+func TestBrokenStdout(t *testing.T) {
+	buffered := newBufferedStdout(closedPipe{})
+	if _, err := io.WriteString(buffered, "listing\n"); err != nil || buffered.broken() {
+		t.Fatalf("buffered write: %v, broken %v", err, buffered.broken())
+	}
+
+	var group sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			buffered.Flush()
+		}()
+	}
+	for index := 0; index < 1000; index++ {
+		fmt.Fprintf(buffered, "entry %d\n", index)
+	}
+	group.Wait()
+
+	if !buffered.broken() {
+		t.Fatal("broken() = false after EPIPE")
+	}
+	if n, err := io.WriteString(buffered, "more\n"); n != 5 || err != nil {
+		t.Errorf("write after EPIPE = %d, %v, want it dropped", n, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		t.Errorf("Flush after EPIPE = %v, want nil", err)
+	}
+}
@@ -0,0 +1,278 @@
+package output
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"eles/filter"
+	"eles/flags"
+)
+
+// captureFile is a capture file being written. Unless appending, the
+// listing goes to a temporary file next to finalPath that replaces it only
+// once the listing is complete, so an interrupted run never leaves a
+// truncated capture behind. The text may be compressed on its way to the
+// file, and with rotation the files previously at finalPath are kept as
+// numbered copies (listing.1.gz, listing.2.gz, ...).
+type captureFile struct {
+	finalPath   string
+	compression string // "gzip", "zstd" or "" for none.
+	appendMode  bool
+	noClobber   bool
+	rotate      bool
+	rotateSize  int64 // Uncompressed bytes after which a new file is started, 0 for none.
+	keep        int   // Rotated files kept, 0 for all of them.
+
+	file        *os.File
+	stream      io.Writer // Buffer in front of the file or its compressor.
+	closeStream func() error
+	written     int64
+	lastByte    byte
+	failed      error
+}
+
+// openCapture creates the parent directories of capturePath and opens the
+// file the listing is written to. With --no-clobber an existing file is an
+// error.
+func openCapture(capturePath string, options flags.Options) (*captureFile, error) {
+	if options.NoClobber {
+		if _, err := os.Lstat(capturePath); err == nil {
+			return nil, &os.PathError{Op: "create", Path: capturePath, Err: syscall.EEXIST}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(capturePath), 0755); err != nil {
+		return nil, err
+	}
+
+	capture := &captureFile{
+		finalPath:   capturePath,
+		compression: compressionFor(capturePath, options.Compress),
+		appendMode:  options.Append,
+		noClobber:   options.NoClobber,
+		rotate:      options.Rotate || options.RotateSize > 0 || options.Keep > 0,
+		rotateSize:  options.RotateSize,
+		keep:        options.Keep,
+	}
+	if err := capture.open(); err != nil {
+		return nil, err
+	}
+	return capture, nil
+}
+
+// compressionFor returns the compression of a capture file: the one given
+// with --compress, or else the one its extension names (.gz or .zst).
+func compressionFor(capturePath string, compress string) string {
+	switch compress {
+	case "none":
+		return ""
+	case "gzip", "zstd":
+		return compress
+	}
+	switch filepath.Ext(capturePath) {
+	case ".gz":
+		return "gzip"
+	case ".zst":
+		return "zstd"
+	}
+	return ""
+}
+
+// open starts a new file: finalPath itself when appending, a temporary
+// file next to it otherwise.
+func (c *captureFile) open() error {
+	var file *os.File
+	var err error
+	if c.appendMode {
+		file, err = os.OpenFile(c.finalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	} else {
+		file, err = os.CreateTemp(filepath.Dir(c.finalPath), "."+filepath.Base(c.finalPath)+".*.tmp")
+		if err == nil {
+			err = file.Chmod(0644)
+		}
+	}
+	if err != nil {
+		c.abandon(file)
+		return err
+	}
+	filter.ExcludeFile(file.Name())
+
+	stream, closeStream, err := compressor(file, c.compression)
+	if err != nil {
+		c.abandon(file)
+		return err
+	}
+	buffered := bufio.NewWriterSize(stream, bufferSize)
+	c.file, c.stream = file, buffered
+	c.closeStream = func() error {
+		err := buffered.Flush()
+		if closeErr := closeStream(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	c.written, c.lastByte = 0, 0
+	return nil
+}
+
+// abandon closes a file that could not be set up and removes it unless it
+// is the appended capture itself.
+func (c *captureFile) abandon(file *os.File) {
+	if file == nil {
+		return
+	}
+	file.Close()
+	if !c.appendMode {
+		os.Remove(file.Name())
+	}
+}
+
+// compressor returns the writer that compresses into file and the function
+// that completes the compressed stream. zstd is run as an external program
+// since the standard library has no encoder for it.
+func compressor(file *os.File, compression string) (io.Writer, func() error, error) {
+	switch compression {
+	case "gzip":
+		gzipWriter := gzip.NewWriter(file)
+		return gzipWriter, gzipWriter.Close, nil
+	case "zstd":
+		command := exec.Command("zstd", "-q", "-c")
+		command.Stdout = file
+		command.Stderr = os.Stderr
+		input, err := command.StdinPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := command.Start(); err != nil {
+			return nil, nil, fmt.Errorf("cannot run zstd: %w", err)
+		}
+		return input, func() error {
+			input.Close()
+			return command.Wait()
+		}, nil
+	}
+	return file, func() error { return nil }, nil
+}
+
+// Write writes p to the current file. With --rotate-size a new file is
+// started once the current one holds enough text, at a line boundary so
+// no line is split between two files.
+func (c *captureFile) Write(p []byte) (int, error) {
+	if c.failed != nil {
+		return 0, c.failed
+	}
+	if c.rotateSize > 0 && c.written >= c.rotateSize && c.lastByte == '\n' {
+		if err := c.finish(); err != nil {
+			c.failed = err
+			return 0, err
+		}
+		if err := c.open(); err != nil {
+			c.failed = err
+			return 0, err
+		}
+	}
+	n, err := c.stream.Write(p)
+	c.written += int64(n)
+	if n > 0 {
+		c.lastByte = p[n-1]
+	}
+	return n, err
+}
+
+// finish completes the compressed stream, closes the file and moves a
+// temporary file into place, rotating the previous captures first. With
+// --no-clobber the file is linked instead of renamed, so a file created at
+// finalPath in the meantime is not replaced either.
+func (c *captureFile) finish() error {
+	if c.file == nil {
+		return c.failed
+	}
+	err := c.closeStream()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	tempPath := c.file.Name()
+	c.file = nil
+	if c.appendMode {
+		return err
+	}
+
+	if err == nil && c.rotate {
+		err = c.rotateOld()
+	}
+	if err == nil {
+		if c.noClobber {
+			err = os.Link(tempPath, c.finalPath)
+		} else {
+			err = os.Rename(tempPath, c.finalPath)
+		}
+	}
+	// After a rename the temporary name no longer exists and this is a no-op.
+	os.Remove(tempPath)
+	return err
+}
+
+// discard removes the file being written, when the run is aborted.
+func (c *captureFile) discard() {
+	if c.file == nil {
+		return
+	}
+	c.closeStream()
+	c.abandon(c.file)
+	c.file = nil
+}
+
+// rotateOld shifts the previous captures out of the way of the new one:
+// number N becomes N+1, finalPath becomes number 1, and numbers beyond
+// --keep are removed.
+func (c *captureFile) rotateOld() error {
+	last := 0
+	for fileExists(RotatedName(c.finalPath, last+1)) {
+		last++
+	}
+	for index := last; index >= 0; index-- {
+		oldPath := RotatedName(c.finalPath, index)
+		if index == 0 && !fileExists(oldPath) {
+			break
+		}
+		if c.keep > 0 && index+1 > c.keep {
+			if err := os.Remove(oldPath); err != nil {
+				return err
+			}
+			continue
+		}
+		newPath := RotatedName(c.finalPath, index+1)
+		filter.ExcludeFile(newPath)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotatedName returns the name of the rotated copy number index of a
+// capture file: the number goes before a compression extension
+// (listing.gz → listing.1.gz) and at the end otherwise (listing.txt →
+// listing.txt.1). Index 0 is the capture file itself.
+func RotatedName(capturePath string, index int) string {
+	if index == 0 {
+		return capturePath
+	}
+	extension := filepath.Ext(capturePath)
+	if extension == ".gz" || extension == ".zst" {
+		return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(capturePath, extension), index, extension)
+	}
+	return fmt.Sprintf("%s.%d", capturePath, index)
+}
+
+// fileExists reports whether something exists at filePath.
+func fileExists(filePath string) bool {
+	_, err := os.Lstat(filePath)
+	return err == nil
+}
@@ -0,0 +1,253 @@
+package output
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"eles/flags"
+)
+
+// writeCapture writes each text to a capture of capturePath opened with
+// options, as one run does, and completes it.
+func writeCapture(t *testing.T, capturePath string, options flags.Options, texts ...string) {
+	t.Helper()
+	capture, err := openCapture(capturePath, options)
+	if err != nil {
+		t.Fatalf("openCapture: %v", err)
+	}
+	for _, text := range texts {
+		if _, err := io.WriteString(capture, text); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := capture.finish(); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+}
+
+// readText returns the content of a file, decompressed when its name ends
+// in .gz.
+func readText(t *testing.T, filePath string) string {
+	t.Helper()
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if filepath.Ext(filePath) == ".gz" {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", filePath, err)
+		}
+		reader = gzipReader
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("%s: %v", filePath, err)
+	}
+	return string(content)
+}
+
+// checkFiles checks that directory holds exactly the named files, so no
+// temporary file is left behind.
+func checkFiles(t *testing.T, directory string, names ...string) {
+	t.Helper()
+	dirEntries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range dirEntries {
+		got = append(got, entry.Name())
+	}
+	slices.Sort(names)
+	if !slices.Equal(got, names) {
+		t.Errorf("files = %q, want %q", got, names)
+	}
+}
+
+func TestRotatedName(t *testing.T) {
+	tests := []struct {
+		capturePath string
+		index       int
+		want        string
+	}{
+		{"listing.txt", 0, "listing.txt"},
+		{"listing.txt", 1, "listing.txt.1"},
+		{"listing", 3, "listing.3"},
+		{"listing.gz", 1, "listing.1.gz"},
+		{"logs/listing.txt.gz", 12, "logs/listing.txt.12.gz"},
+		{"listing.zst", 2, "listing.2.zst"},
+		{"archive.tar", 1, "archive.tar.1"},
+	}
+	for _, test := range tests {
+		if got := RotatedName(test.capturePath, test.index); got != test.want {
+			t.Errorf("RotatedName(%q, %d) = %q, want %q", test.capturePath, test.index, got, test.want)
+		}
+	}
+}
+
+func TestCaptureReplaces(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.txt")
+	writeCapture(t, capturePath, flags.Options{}, "first\n")
+	writeCapture(t, capturePath, flags.Options{}, "second\n")
+	if got := readText(t, capturePath); got != "second\n" {
+		t.Errorf("capture = %q, want %q", got, "second\n")
+	}
+	checkFiles(t, directory, "listing.txt")
+}
+
+func TestCaptureCreatesDirectories(t *testing.T) {
+	capturePath := filepath.Join(t.TempDir(), "a", "b", "listing.txt")
+	writeCapture(t, capturePath, flags.Options{}, "text\n")
+	if got := readText(t, capturePath); got != "text\n" {
+		t.Errorf("capture = %q, want %q", got, "text\n")
+	}
+}
+
+func TestCaptureDiscard(t *testing.T) {
+	directory := t.TempDir()
+	capture, err := openCapture(filepath.Join(directory, "listing.txt"), flags.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(capture, "partial")
+	capture.discard()
+	checkFiles(t, directory)
+}
+
+func TestRotation(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.txt")
+	for _, text := range []string{"1\n", "2\n", "3\n"} {
+		writeCapture(t, capturePath, flags.Options{Rotate: true}, text)
+	}
+	for index, want := range []string{"3\n", "2\n", "1\n"} {
+		if got := readText(t, RotatedName(capturePath, index)); got != want {
+			t.Errorf("%s = %q, want %q", RotatedName(capturePath, index), got, want)
+		}
+	}
+	checkFiles(t, directory, "listing.txt", "listing.txt.1", "listing.txt.2")
+}
+
+func TestRotationKeep(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.gz")
+	for _, text := range []string{"1\n", "2\n", "3\n", "4\n", "5\n"} {
+		writeCapture(t, capturePath, flags.Options{Keep: 2}, text)
+	}
+	for index, want := range []string{"5\n", "4\n", "3\n"} {
+		if got := readText(t, RotatedName(capturePath, index)); got != want {
+			t.Errorf("%s = %q, want %q", RotatedName(capturePath, index), got, want)
+		}
+	}
+	checkFiles(t, directory, "listing.gz", "listing.1.gz", "listing.2.gz")
+}
+
+func TestRotateSize(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.txt")
+	// The size is checked before each write, so a line is never split and
+	// a file may exceed the size by the line that reaches it.
+	writeCapture(t, capturePath, flags.Options{RotateSize: 10}, "line 1\n", "line 2\n", "li", "ne 3\n", "line 4\n", "line 5\n")
+	for index, want := range []string{"line 5\n", "line 3\nline 4\n", "line 1\nline 2\n"} {
+		if got := readText(t, RotatedName(capturePath, index)); got != want {
+			t.Errorf("%s = %q, want %q", RotatedName(capturePath, index), got, want)
+		}
+	}
+	checkFiles(t, directory, "listing.txt", "listing.txt.1", "listing.txt.2")
+}
+
+func TestNoClobber(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.txt")
+	if err := os.WriteFile(capturePath, []byte("kept\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openCapture(capturePath, flags.Options{NoClobber: true}); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("openCapture of an existing file = %v, want it to exist", err)
+	}
+	if got := readText(t, capturePath); got != "kept\n" {
+		t.Errorf("capture = %q, want %q", got, "kept\n")
+	}
+}
+
+// TestNoClobberRace checks that a file created at the capture path while
+// the listing runs is not replaced: the capture is linked into place, not
+// renamed over it.
+func TestNoClobberRace(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.txt")
+	capture, err := openCapture(capturePath, flags.Options{NoClobber: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(capture, "listing\n")
+	if err := os.WriteFile(capturePath, []byte("created meanwhile\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := capture.finish(); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("finish = %v, want the capture to exist", err)
+	}
+	if got := readText(t, capturePath); got != "created meanwhile\n" {
+		t.Errorf("capture = %q, want %q", got, "created meanwhile\n")
+	}
+	checkFiles(t, directory, "listing.txt")
+}
+
+func TestNoClobberFresh(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.txt")
+	writeCapture(t, capturePath, flags.Options{NoClobber: true}, "text\n")
+	if got := readText(t, capturePath); got != "text\n" {
+		t.Errorf("capture = %q, want %q", got, "text\n")
+	}
+	checkFiles(t, directory, "listing.txt")
+}
+
+func TestGzip(t *testing.T) {
+	directory := t.TempDir()
+	for _, test := range []struct {
+		name    string
+		options flags.Options
+		gzipped bool
+	}{
+		{"listing.gz", flags.Options{}, true},
+		{"listing.txt", flags.Options{Compress: "gzip"}, true},
+		{"plain.gz", flags.Options{Compress: "none"}, false},
+	} {
+		capturePath := filepath.Join(directory, test.name)
+		writeCapture(t, capturePath, test.options, "one\n", "two\n")
+		content, err := os.ReadFile(capturePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gzipped := len(content) > 2 && content[0] == 0x1f && content[1] == 0x8b; gzipped != test.gzipped {
+			t.Errorf("%s: gzipped = %v, want %v", test.name, gzipped, test.gzipped)
+		}
+	}
+	if got := readText(t, filepath.Join(directory, "listing.gz")); got != "one\ntwo\n" {
+		t.Errorf("listing.gz = %q, want %q", got, "one\ntwo\n")
+	}
+}
+
+// TestGzipAppend checks that each appending run adds a gzip member, which
+// readers decompress as the concatenated text.
+func TestGzipAppend(t *testing.T) {
+	directory := t.TempDir()
+	capturePath := filepath.Join(directory, "listing.gz")
+	writeCapture(t, capturePath, flags.Options{Append: true}, "first\n")
+	writeCapture(t, capturePath, flags.Options{Append: true}, "second\n")
+	if got := readText(t, capturePath); got != "first\nsecond\n" {
+		t.Errorf("capture = %q, want %q", got, "first\nsecond\n")
+	}
+	checkFiles(t, directory, "listing.gz")
+}
@@ -1,22 +1,80 @@
 package output
 
 import (
-	"io"  
-	"log" 
-	"os"  
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"eles/flags"
+	"eles/status"
 )
 
-// NewOutput returns an io.Writer that writes to stdout or to a capture file,
-// along with a cleanup function to close any resources.
-func NewOutput(capture bool) (io.Writer, func()) {
-	if capture {
-		f, err := os.Create("output.txt")
-		if err != nil {
-		log.Fatalf("Error creating capture file: %v", err)
+// DefaultCaptureFile is the capture file of -c when --output is not given.
+const DefaultCaptureFile = "output.txt"
+
+// NewOutput returns the writer the listing is rendered to, along with a
+// cleanup function that flushes the output, completes the capture files and
+// closes any resources. The listing goes to stdout, to the -c/--output
+// capture file and to every --sink, each with its own format and color
+// policy; the files written are never part of the listing they record.
+// Output is buffered; it is flushed before every diagnostic, and when
+// stdout is closed early (e.g. piped into head) the run stops quietly.
+// With --pager a listing longer than the terminal goes through $PAGER.
+func NewOutput(options flags.Options) (io.Writer, func()) {
+	writer := &Writer{}
+	now := time.Now()
+	// A closed pipe is noticed as EPIPE from a write, so the capture files
+	// can be removed before exiting instead of being killed by SIGPIPE.
+	signal.Ignore(syscall.SIGPIPE)
+	stdout := io.Writer(os.Stdout)
+	if options.Pager {
+		if writer.pager = newPager(os.Stdout); writer.pager != nil {
+			stdout = writer.pager
+		}
+	}
+	writer.stdout = newBufferedStdout(stdout)
+	status.SetFlush(func() { writer.stdout.Flush() })
+
+	// A --sink to "-" replaces the text listing on stdout.
+	stdoutTaken := false
+	for _, sink := range options.Sinks {
+		if sink.Path == "-" {
+			stdoutTaken = true
+		}
+	}
+	if !stdoutTaken {
+		writer.addText(writer.stdout, options.TerminalColor())
+	}
+
+	if options.Capture && options.OutputPath != "-" {
+		capturePath := options.OutputPath
+		if capturePath == "" {
+			capturePath = DefaultCaptureFile
 		}
-		writer := io.MultiWriter(os.Stdout, f)
-			return writer, func() { f.Close() }
+		writer.addSink(flags.Sink{Path: capturePath, Format: "text"}, options, now)
+	}
+	for _, sink := range options.Sinks {
+		writer.addSink(sink, options, now)
+	}
+	return writer, writer.close
+}
+
+// ExpandName replaces the {date}, {time} and {host} placeholders of a
+// capture file name, e.g. "listing-{date}-{host}.txt".
+func ExpandName(name string, now time.Time) string {
+	if !strings.Contains(name, "{") {
+		return name
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
 	}
-	
-	return os.Stdout, func() {} // An empty cleanup function since there's nothing to close.
+	return strings.NewReplacer(
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{host}", host,
+	).Replace(name)
 }
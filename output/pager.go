@@ -0,0 +1,180 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"eles/width"
+)
+
+// DefaultPager is the pager of --pager when $PAGER is not set; -R keeps
+// the colors.
+const DefaultPager = "less -R"
+
+// pager holds the listing until it no longer fits on the screen and then
+// sends it through $PAGER. A listing that fits is printed as it is, when
+// the pager cannot be started the listing goes to stdout instead, and when
+// the pager is quit early the rest of the listing is dropped while the run
+// still completes its capture files.
+type pager struct {
+	stdout  *os.File
+	rows    int
+	columns int
+
+	pending     bytes.Buffer // Output held while it fits on the screen.
+	counted     int          // Bytes of pending whose screen rows are counted.
+	screenRows  int
+	command     *exec.Cmd
+	input       io.WriteCloser
+	passThrough bool // Write to stdout directly: the listing did not need a pager or it failed.
+	quit        bool // The pager exited before the end of the listing.
+}
+
+// newPager returns a pager for stdout, or nil when stdout is not a terminal.
+func newPager(stdout *os.File) *pager {
+	rows, columns, ok := terminalSize(stdout)
+	if !ok {
+		return nil
+	}
+	return &pager{stdout: stdout, rows: rows, columns: columns}
+}
+
+// terminalSize returns the number of rows and columns of the terminal
+// file is connected to.
+func terminalSize(file *os.File) (int, int, bool) {
+	rows, columns, isTerminal := windowSize(file)
+	if !isTerminal || rows == 0 || columns == 0 {
+		return 0, 0, false
+	}
+	return rows, columns, true
+}
+
+// windowSize returns the size the terminal on file reports, which is 0 by
+// 0 on terminals that were never given one, and whether file is a terminal.
+func windowSize(file *os.File) (int, int, bool) {
+	var size struct {
+		rows, columns, xPixels, yPixels uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, 0, false
+	}
+	return int(size.rows), int(size.columns), true
+}
+
+// defaultWidth is the width of TerminalWidth on a terminal that reports
+// none, as in GNU ls.
+const defaultWidth = 80
+
+// TerminalWidth is the number of columns short listings are laid out in:
+// $COLUMNS, or else the width of the terminal on stdout. It is 0 when
+// stdout is not a terminal, so listings written to pipes and files keep
+// their names on one line.
+var TerminalWidth = sync.OnceValue(func() int {
+	_, columns, isTerminal := windowSize(os.Stdout)
+	if !isTerminal {
+		return 0
+	}
+	if value, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && value > 0 {
+		return value
+	}
+	if columns == 0 {
+		return defaultWidth
+	}
+	return columns
+})
+
+func (p *pager) Write(data []byte) (int, error) {
+	switch {
+	case p.quit:
+		return len(data), nil
+	case p.input != nil:
+		if _, err := p.input.Write(data); err != nil {
+			if !errors.Is(err, syscall.EPIPE) {
+				return 0, err
+			}
+			p.quit = true
+		}
+		return len(data), nil
+	case p.passThrough:
+		return p.stdout.Write(data)
+	}
+
+	p.pending.Write(data)
+	p.countRows()
+	// One row is left for the prompt the shell prints after the listing.
+	if p.screenRows >= p.rows {
+		p.start()
+	}
+	return len(data), nil
+}
+
+// countRows adds the screen rows of the complete lines held in pending,
+// with lines wider than the terminal taking several rows.
+func (p *pager) countRows() {
+	for {
+		newline := bytes.IndexByte(p.pending.Bytes()[p.counted:], '\n')
+		if newline < 0 {
+			return
+		}
+		line := string(p.pending.Bytes()[p.counted : p.counted+newline])
+		p.screenRows += max(1, (width.StringWidth(line)+p.columns-1)/p.columns)
+		p.counted += newline + 1
+	}
+}
+
+// start runs the pager and hands it the output held so far. When the
+// pager cannot be started, the output goes to stdout.
+func (p *pager) start() {
+	pagerCommand := os.Getenv("PAGER")
+	if pagerCommand == "" {
+		pagerCommand = DefaultPager
+	}
+	// A missing pager is found before it is started: the shell running it
+	// would otherwise exit at once and the listing would be lost.
+	programName := ""
+	if fields := strings.Fields(pagerCommand); len(fields) > 0 {
+		programName = fields[0]
+	}
+	_, err := exec.LookPath(programName)
+	command := exec.Command("sh", "-c", pagerCommand)
+	command.Stdout = p.stdout
+	command.Stderr = os.Stderr
+	var input io.WriteCloser
+	if err == nil {
+		input, err = command.StdinPipe()
+	}
+	if err == nil {
+		err = command.Start()
+	}
+	if err != nil {
+		p.passThrough = true
+		p.stdout.Write(p.pending.Bytes())
+		p.pending.Reset()
+		return
+	}
+	p.command, p.input = command, input
+	held := p.pending.Bytes()
+	p.pending = bytes.Buffer{}
+	p.Write(held)
+}
+
+// close prints a listing that fit on the screen, or waits for the user to
+// quit the pager.
+func (p *pager) close() {
+	if p.input == nil {
+		p.stdout.Write(p.pending.Bytes())
+		p.pending.Reset()
+		return
+	}
+	p.input.Close()
+	p.command.Wait()
+}
@@ -0,0 +1,255 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"eles/filter"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+)
+
+// Recorder is implemented by writers that also take the listed entries as
+// data, for destinations that write a structured format instead of the text.
+type Recorder interface {
+	Record(entryPath string, entry fs.DirEntry)
+}
+
+// recorder is a destination written from the listed entries.
+type recorder interface {
+	Recorder
+	flush() error
+}
+
+// Writer sends the rendered listing to every text destination and the
+// listed entries to every structured one, so all of them come from the
+// same traversal.
+type Writer struct {
+	text      []io.Writer
+	recorders []recorder
+	captures  []*captureFile
+	stdout    *bufferedStdout
+	pager     *pager
+}
+
+// Write writes p to every text destination.
+func (w *Writer) Write(p []byte) (int, error) {
+	var firstErr error
+	for _, destination := range w.text {
+		if _, err := destination.Write(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.stopIfBroken()
+	return len(p), firstErr
+}
+
+// Record passes one listed entry to every structured destination.
+func (w *Writer) Record(entryPath string, entry fs.DirEntry) {
+	for _, destination := range w.recorders {
+		destination.Record(entryPath, entry)
+	}
+	w.stopIfBroken()
+}
+
+// addText adds a text destination; without color the ANSI sequences of
+// the rendered listing are stripped from what it receives.
+func (w *Writer) addText(destination io.Writer, color bool) {
+	if !color {
+		destination = &ansiStripper{destination: destination}
+	}
+	w.text = append(w.text, destination)
+}
+
+// addSink opens the destination of sink and adds it in its format.
+// A destination that cannot be created ends the run with exit status 2.
+func (w *Writer) addSink(sink flags.Sink, options flags.Options, now time.Time) {
+	destination := io.Writer(w.stdout)
+	if sink.Path != "-" {
+		capturePath := ExpandName(sink.Path, now)
+		capture, err := openCapture(capturePath, options)
+		if err != nil {
+			w.discard()
+			status.ReportError(status.Serious, "cannot create capture file", capturePath, err)
+			os.Exit(status.ExitCode())
+		}
+		filter.ExcludeFile(capturePath)
+		w.captures = append(w.captures, capture)
+		destination = capture
+	}
+
+	switch sink.Format {
+	case "json":
+		w.recorders = append(w.recorders, newJSONRecorder(destination))
+	case "csv":
+		w.recorders = append(w.recorders, newCSVRecorder(destination))
+	default:
+		w.addText(destination, sink.Color)
+	}
+}
+
+// close flushes stdout and the structured destinations and completes the
+// capture files.
+func (w *Writer) close() {
+	for _, destination := range w.recorders {
+		destination.flush()
+	}
+	w.stdout.Flush()
+	w.stopIfBroken()
+	if w.pager != nil {
+		w.pager.close()
+	}
+	for _, capture := range w.captures {
+		if err := capture.finish(); err != nil {
+			status.ReportError(status.Serious, "cannot write capture file", capture.finalPath, err)
+		}
+	}
+}
+
+// discard removes the capture files opened so far, when the run is aborted.
+func (w *Writer) discard() {
+	for _, capture := range w.captures {
+		capture.discard()
+	}
+}
+
+// stopIfBroken ends the run when the reader of stdout went away: the
+// unfinished capture files are removed and no error is reported. It is
+// only called by the goroutine writing the listing, the one that writes
+// the capture files, even when the broken pipe was found by a worker
+// flushing stdout before a diagnostic.
+func (w *Writer) stopIfBroken() {
+	if w.stdout.broken() {
+		w.discard()
+		os.Exit(status.ExitCode())
+	}
+}
+
+// ansiStripper removes ANSI escape sequences from the text written through
+// it. A sequence split across writes is recognised by the state kept
+// between them.
+type ansiStripper struct {
+	destination io.Writer
+	state       int // 0 in text, 1 after ESC, 2 inside a CSI sequence.
+}
+
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	plain := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch {
+		case s.state == 1 && b == '[':
+			s.state = 2
+		case s.state == 1:
+			s.state = 0 // A two-byte escape sequence.
+		case s.state == 2:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = 0
+			}
+		case b == 0x1b:
+			s.state = 1
+		default:
+			plain = append(plain, b)
+		}
+	}
+	if _, err := s.destination.Write(plain); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// entryRecord is one listed entry as written to json and csv sinks.
+// It is built from the information cached during the traversal.
+type entryRecord struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Mode     string `json:"mode,omitempty"`
+	Links    uint64 `json:"links,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// newEntryRecord describes one entry; an entry that could not be stat'ed
+// only has its path, name, type and error.
+func newEntryRecord(entryPath string, entry fs.DirEntry) entryRecord {
+	record := entryRecord{
+		Path: entryPath,
+		Name: filepath.Base(entryPath),
+		Type: utils.FileTypeName(entry.Type()),
+	}
+	entryInfo, err := entry.Info()
+	if err != nil {
+		record.Error = status.Describe(err)
+		return record
+	}
+	record.Type = utils.FileTypeName(entryInfo.Mode())
+	record.Mode = utils.GetPermissions(entryInfo)
+	record.Size = entryInfo.Size()
+	record.Modified = entryInfo.ModTime().Format(time.RFC3339)
+	if stat, ok := entryInfo.Sys().(*syscall.Stat_t); ok {
+		record.Links = uint64(stat.Nlink)
+		record.Owner = utils.LookupOwner(stat.Uid)
+		record.Group = utils.LookupGroup(stat.Gid)
+	}
+	return record
+}
+
+// jsonRecorder writes one JSON object per entry (JSON Lines).
+type jsonRecorder struct {
+	encoder *json.Encoder
+}
+
+func newJSONRecorder(destination io.Writer) *jsonRecorder {
+	encoder := json.NewEncoder(destination)
+	encoder.SetEscapeHTML(false)
+	return &jsonRecorder{encoder: encoder}
+}
+
+func (r *jsonRecorder) Record(entryPath string, entry fs.DirEntry) {
+	r.encoder.Encode(newEntryRecord(entryPath, entry))
+}
+
+func (r *jsonRecorder) flush() error { return nil }
+
+// csvRecorder writes a header row and one row per entry.
+type csvRecorder struct {
+	writer *csv.Writer
+}
+
+func newCSVRecorder(destination io.Writer) *csvRecorder {
+	writer := csv.NewWriter(destination)
+	writer.Write([]string{"path", "name", "type", "mode", "links", "owner", "group", "size", "modified", "error"})
+	return &csvRecorder{writer: writer}
+}
+
+func (r *csvRecorder) Record(entryPath string, entry fs.DirEntry) {
+	record := newEntryRecord(entryPath, entry)
+	r.writer.Write([]string{
+		record.Path,
+		record.Name,
+		record.Type,
+		record.Mode,
+		strconv.FormatUint(record.Links, 10),
+		record.Owner,
+		record.Group,
+		strconv.FormatInt(record.Size, 10),
+		record.Modified,
+		record.Error,
+	})
+}
+
+func (r *csvRecorder) flush() error {
+	r.writer.Flush()
+	return r.writer.Error()
+}
@@ -0,0 +1,166 @@
+package recursive
+
+import (
+	"io/fs"
+	"os"
+	"runtime"
+
+	"eles/count"
+	"eles/dirconfig"
+	"eles/du"
+	"eles/filter"
+	"eles/flags"
+	"eles/sort"
+	"eles/status"
+	"eles/utils"
+)
+
+// scanResult is a directory read, filtered and sorted, ready to be printed
+// with options, which include the preferences of its .mylsrc. The problems
+// found while reading it wait in diagnostics until its section is printed,
+// so they appear in the same place whichever worker read it and when.
+type scanResult struct {
+	id          utils.FileID
+	statErr     error
+	options     flags.Options
+	entries     []fs.DirEntry
+	err         error
+	diagnostics *status.Queue
+}
+
+// pendingScan is a directory read started ahead of the output.
+type pendingScan struct {
+	done   chan struct{}
+	result scanResult
+}
+
+// scanner reads directories on a bounded pool of workers. At most window
+// directories are read ahead of the one being printed, which bounds memory
+// to the entries of those directories however large the tree is.
+type scanner struct {
+	options flags.Options
+	workers utils.Workers
+	window  int
+	started int
+}
+
+// newScanner creates a scanner running up to jobs directory reads at once.
+// A jobs value of 0 uses one worker per CPU, 1 reads sequentially.
+func newScanner(options flags.Options) *scanner {
+	jobs := options.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	window := 0
+	if jobs > 1 {
+		window = jobs * 8
+	}
+	return &scanner{
+		options: options,
+		workers: utils.NewWorkers(jobs),
+		window:  window,
+	}
+}
+
+// prefetch starts reading the first queued directories that are not being
+// read yet, as long as the read-ahead window has room.
+func (s *scanner) prefetch(queue []*directoryNode) {
+	for _, node := range queue {
+		if s.started >= s.window {
+			return
+		}
+		if node.pending != nil || node.listed {
+			continue
+		}
+		node.pending = &pendingScan{done: make(chan struct{})}
+		s.started++
+		go func(node *directoryNode, pending *pendingScan) {
+			s.workers.Acquire()
+			pending.result = s.scan(node.path)
+			s.workers.Release()
+			close(pending.done)
+		}(node, node.pending)
+	}
+}
+
+// result waits for the directory read of node, reading it now if it was
+// never prefetched.
+func (s *scanner) result(node *directoryNode) scanResult {
+	if node.pending == nil {
+		return s.scan(node.path)
+	}
+	<-node.pending.done
+	result := node.pending.result
+	node.pending = nil
+	s.started--
+	return result
+}
+
+// scan reads one directory in a worker and records its identity. The --du
+// and --count values of its subdirectories are computed by the same
+// workers, and only when the listing shows them.
+func (s *scanner) scan(directoryPath string) scanResult {
+	diagnostics := &status.Queue{}
+	result := scanResult{options: dirconfig.ApplyQueued(directoryPath, s.options, diagnostics), diagnostics: diagnostics}
+	directoryInfo, err := os.Stat(directoryPath)
+	if err != nil {
+		result.statErr = err
+	} else {
+		result.id = utils.GetFileID(directoryInfo)
+	}
+	result.entries, result.err = readDirectory(directoryPath, ShownAnnotations(result.options), s.workers, diagnostics)
+	return result
+}
+
+// ReadDirectory reads a directory and prepares its entries for display:
+// filtered by the listing rules, with the lstat information of each entry
+// cached so printing does not touch the disk, annotated for --du and
+// --count (see ShownAnnotations to leave out what is not shown), and
+// sorted.
+func ReadDirectory(directoryPath string, options flags.Options) ([]fs.DirEntry, error) {
+	return readDirectory(directoryPath, options, utils.NewWorkers(options.Jobs), nil)
+}
+
+// readDirectory is ReadDirectory with the --du and --count values computed
+// by workers and their problems held in diagnostics.
+func readDirectory(directoryPath string, options flags.Options, workers utils.Workers, diagnostics *status.Queue) ([]fs.DirEntry, error) {
+	dirEntries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		return nil, err
+	}
+	dirEntries = filter.Apply(dirEntries, options, directoryPath)
+	for index, entry := range dirEntries {
+		if entryInfo, err := entry.Info(); err == nil {
+			dirEntries[index] = utils.NewPseudoDirEntry(entryInfo, entry.Name())
+		}
+	}
+	dirEntries = Annotate(dirEntries, directoryPath, options, workers, diagnostics)
+	return sort.SortFiles(dirEntries, options.ToMap()), nil
+}
+
+// Annotate adds the --du totals and --count values to the directories
+// among dirEntries, when those options are given, computed by the idle
+// workers. Unreadable subtrees are reported to diagnostics, or at once
+// when it is nil.
+func Annotate(dirEntries []fs.DirEntry, directoryPath string, options flags.Options, workers utils.Workers, diagnostics *status.Queue) []fs.DirEntry {
+	if options.DiskUsage != "" {
+		dirEntries = du.Annotate(dirEntries, directoryPath, options, workers, diagnostics)
+	}
+	if options.Count != "" {
+		dirEntries = count.Annotate(dirEntries, directoryPath, options, workers, diagnostics)
+	}
+	return dirEntries
+}
+
+// ShownAnnotations returns options without the --du and --count values a
+// listing in their format would compute for nothing: the long format shows
+// both, and -S also orders directories by their --du totals.
+func ShownAnnotations(options flags.Options) flags.Options {
+	if !options.Long {
+		options.Count = ""
+		if !options.SizeSort {
+			options.DiskUsage = ""
+		}
+	}
+	return options
+}
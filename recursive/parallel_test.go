@@ -0,0 +1,166 @@
+package recursive
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"eles/flags"
+)
+
+// makeTree creates a tree of depth levels below root, each directory
+// holding width subdirectories and a few files of different sizes, with
+// more directories than the read-ahead window of eight jobs.
+func makeTree(t *testing.T, root string, depth int, width int) {
+	for index := 0; index < 3; index++ {
+		filePath := filepath.Join(root, fmt.Sprintf("file-%d.txt", index))
+		if err := os.WriteFile(filePath, bytes.Repeat([]byte("x"), index*100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ".hidden"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if depth == 0 {
+		return
+	}
+	for index := 0; index < width; index++ {
+		directoryPath := filepath.Join(root, fmt.Sprintf("dir-%d", index))
+		if err := os.Mkdir(directoryPath, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		makeTree(t, directoryPath, depth-1, width)
+	}
+}
+
+// list runs a recursive listing of root with the given arguments and
+// returns its output.
+func list(root string, arguments ...string) string {
+	options := flags.ParseArgs(nil, append(arguments, "--color=never", root))
+	var output bytes.Buffer
+	RecursiveList(root, options, &output, false)
+	return output.String()
+}
+
+// TestJobsKeepOutput checks that reading directories in parallel does not
+// change the output of any traversal order.
+func TestJobsKeepOutput(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 3, 5)
+
+	for _, traversal := range []string{"depth", "breadth", "post"} {
+		for _, format := range [][]string{nil, {"-l"}, {"-a", "-S"}, {"--flat"}, {"--max-depth=2"}} {
+			name := strings.Join(append([]string{traversal}, format...), " ")
+			t.Run(name, func(t *testing.T) {
+				arguments := append([]string{"-R", "--traversal=" + traversal}, format...)
+				sequential := list(root, append(arguments, "--jobs=1")...)
+				if !strings.Contains(sequential, "dir-4") {
+					t.Fatalf("listing is missing entries:\n%s", sequential)
+				}
+				for run := 0; run < 3; run++ {
+					if parallel := list(root, append(arguments, "--jobs=8")...); parallel != sequential {
+						t.Fatalf("--jobs=8 output differs from --jobs=1\n--jobs=1:\n%s\n--jobs=8:\n%s", sequential, parallel)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestTraversalOrder checks the order of the sections each traversal
+// prints.
+func TestTraversalOrder(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 2, 2)
+
+	tests := []struct {
+		traversal string
+		sections  []string
+	}{
+		{"depth", []string{"", "dir-0", "dir-0/dir-0", "dir-0/dir-1", "dir-1", "dir-1/dir-0", "dir-1/dir-1"}},
+		{"breadth", []string{"", "dir-0", "dir-1", "dir-0/dir-0", "dir-0/dir-1", "dir-1/dir-0", "dir-1/dir-1"}},
+		{"post", []string{"dir-0/dir-0", "dir-0/dir-1", "dir-0", "dir-1/dir-0", "dir-1/dir-1", "dir-1", ""}},
+	}
+	for _, test := range tests {
+		for _, jobs := range []string{"--jobs=1", "--jobs=8"} {
+			t.Run(test.traversal+" "+jobs, func(t *testing.T) {
+				var sections []string
+				for _, line := range strings.Split(list(root, "-R", "--traversal="+test.traversal, jobs), "\n") {
+					if header, ok := strings.CutSuffix(line, ":"); ok {
+						relativePath, err := filepath.Rel(root, header)
+						if err != nil {
+							t.Fatal(err)
+						}
+						sections = append(sections, strings.TrimPrefix(relativePath, "."))
+					}
+				}
+				if strings.Join(sections, " ") != strings.Join(test.sections, " ") {
+					t.Errorf("sections = %q, want %q", sections, test.sections)
+				}
+			})
+		}
+	}
+}
+
+// TestDiagnosticsFollowHeaders checks that the problems found while a
+// directory is read ahead, such as an untrusted .mylsrc, are reported
+// right after its section header, not when a worker happens to read it.
+func TestDiagnosticsFollowHeaders(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	makeTree(t, root, 2, 4)
+	var rcPaths []string
+	for index := 0; index < 4; index++ {
+		rcPath := filepath.Join(root, fmt.Sprintf("dir-%d", index), "dir-1", ".mylsrc")
+		if err := os.WriteFile(rcPath, []byte("reverse = true\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rcPaths = append(rcPaths, rcPath)
+	}
+
+	// The listing and the diagnostics share one file, as on a terminal.
+	combined, err := os.Create(filepath.Join(t.TempDir(), "combined"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer combined.Close()
+	stderr := os.Stderr
+	os.Stderr = combined
+	defer func() { os.Stderr = stderr }()
+	RecursiveList(root, flags.ParseArgs(nil, []string{"-R", "--jobs=8", "--color=never", root}), combined, false)
+	os.Stderr = stderr
+
+	content, err := os.ReadFile(combined.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rcPath := range rcPaths {
+		section := filepath.Dir(rcPath) + ":\nmy-ls: " + rcPath + ": not trusted"
+		if !strings.Contains(string(content), section) {
+			t.Errorf("the warning about %s does not follow its header:\n%s", rcPath, content)
+		}
+	}
+}
+
+func TestShownAnnotations(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		diskUsage string
+		count     string
+	}{
+		{[]string{"--du", "--count"}, "", ""},
+		{[]string{"-l", "--du", "--count"}, "apparent", "immediate"},
+		{[]string{"-S", "--du=allocated", "--count"}, "allocated", ""},
+		{[]string{"--sort=size", "--du"}, "apparent", ""},
+		{[]string{"-l", "--flat", "--count=recursive"}, "", "recursive"},
+	}
+	for _, test := range tests {
+		options := ShownAnnotations(flags.ParseArgs(nil, test.arguments))
+		if options.DiskUsage != test.diskUsage || options.Count != test.count {
+			t.Errorf("ShownAnnotations(%q) keeps --du=%q --count=%q, want %q and %q", test.arguments, options.DiskUsage, options.Count, test.diskUsage, test.count)
+		}
+	}
+}
@@ -3,15 +3,46 @@ package recursive
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"eles/display"
-	"eles/filter"
-	"eles/sort"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+	"eles/walk"
 )
 
+// walker carries the options shared by every directory of one recursive listing.
+type walker struct {
+	options      flags.Options
+	outputWriter io.Writer
+	descent      walk.Descent
+	scanner      *scanner
+	// sectionsPrinted counts the "dir:" headers written so far.
+	sectionsPrinted int
+	// separate is set when output precedes the listing, so its first
+	// section needs a blank line too.
+	separate bool
+}
+
+// directoryNode is a directory waiting to be listed.
+type directoryNode struct {
+	path   string
+	depth  int
+	parent *directoryNode
+	// id is filled in once the directory has been listed, so descendants
+	// can recognise it when a symlink or bind mount leads back to it.
+	id      utils.FileID
+	pending *pendingScan
+	// listed marks a post-order directory that was read and whose section
+	// is printed when it comes off the queue again; result is kept until then.
+	listed bool
+	result scanResult
+}
+
 // joinDisplayPath joins parent and child directory names, preserving the "./" prefix when the parent is "." or starts with "./".
 func joinDisplayPath(parentPath, childName string) string {
 	if parentPath == "." {
@@ -27,33 +58,158 @@ func joinDisplayPath(parentPath, childName string) string {
 }
 
 // RecursiveList lists directories recursively.
-func RecursiveList(directoryPath string, optionFlags map[string]bool, captureOutput bool, outputWriter io.Writer) {
-	fmt.Fprintf(outputWriter, "\n%s:\n", directoryPath)
-
-	dirEntries, err := os.ReadDir(directoryPath)
-	if err != nil {
-		fmt.Fprintf(outputWriter, "Error: %v\n", err)
-		return
+// The listed directory is at depth 0; --max-depth and --min-depth bound the
+// depths that are descended into and printed, --prune stops descent below
+// matching directories and -x stays on the file system of directoryPath.
+// With --follow (or -L) symbolic links to directories are entered as well;
+// a directory that is already being listed is reported instead of looping.
+// Directories are read by up to --jobs workers ahead of the output, which
+// is still written in the order selected by --traversal.
+// With --flat no section headers are printed; every entry is written on its
+// own line as a full path instead. Entries are still sorted and aligned
+// per directory, so the output can stream.
+// Sections are separated by a blank line, and so is the first one from
+// the output before it when separate is set. RecursiveList reports whether
+// it printed any section, so the caller can separate what follows.
+func RecursiveList(directoryPath string, options flags.Options, outputWriter io.Writer, separate bool) bool {
+	listWalker := &walker{
+		options:      options,
+		outputWriter: outputWriter,
+		descent:      walk.Descent{Options: options},
+		separate:     separate,
+	}
+	listWalker.scanner = newScanner(options)
+	if rootInfo, err := os.Stat(directoryPath); err == nil {
+		listWalker.descent.RootDevice = utils.DeviceID(rootInfo)
 	}
+	listWalker.run(&directoryNode{path: directoryPath})
+	return listWalker.sectionsPrinted > 0
+}
 
-	dirEntries = filter.FilterFiles(dirEntries, optionFlags, directoryPath)
-	dirEntries = sort.SortFiles(dirEntries, optionFlags)
-	display.DisplayFiles(dirEntries, directoryPath, optionFlags, outputWriter, captureOutput)
+// run lists every directory reachable from root. The order of the sections
+// follows --traversal: subdirectories are queued in front of the remaining
+// work for depth-first pre-order, behind it for breadth-first order, and in
+// front of their parent's section for post-order. The first directories of
+// the queue are read ahead by the scanner.
+func (w *walker) run(root *directoryNode) {
+	queue := []*directoryNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		w.scanner.prefetch(queue)
 
-	for _, entry := range dirEntries {
-		if entry.Name() == "." || entry.Name() == ".." {
+		// In post-order a directory comes back once its subdirectories are done.
+		if node.listed {
+			w.printSection(node, node.result)
+			node.result = scanResult{}
 			continue
 		}
-		entryInfo, err := entry.Info()
-		if err != nil {
+
+		result := w.scanner.result(node)
+		if w.alreadyListed(node, result) {
 			continue
 		}
-		if entry.Type()&os.ModeSymlink != 0 {
-			continue
+		children := w.subdirectories(node, result)
+
+		switch w.options.Traversal {
+		case "breadth":
+			w.printSection(node, result)
+			queue = append(queue, children...)
+		case "post":
+			node.listed = true
+			node.result = result
+			queue = append(append(children, node), queue...)
+		default:
+			w.printSection(node, result)
+			queue = append(children, queue...)
+		}
+	}
+}
+
+// alreadyListed reports (and skips) a directory that is one of its own
+// ancestors, reached again through a symlink or bind mount.
+func (w *walker) alreadyListed(node *directoryNode, result scanResult) bool {
+	if result.statErr != nil {
+		return false
+	}
+	node.id = result.id
+	for ancestor := node.parent; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor.id == node.id {
+			result.diagnostics.Flush()
+			walk.ReportLoop(node.path)
+			return true
+		}
+	}
+	return false
+}
+
+// printSection prints the header and entries of one directory. Sections
+// are separated by a blank line, with none before the first one unless
+// output precedes the listing, as GNU ls does.
+func (w *walker) printSection(node *directoryNode, result scanResult) {
+	printed := node.depth >= w.options.MinDepth
+	if printed && !w.options.Flat {
+		if w.sectionsPrinted > 0 || w.separate {
+			fmt.Fprintln(w.outputWriter)
+		}
+		fmt.Fprintf(w.outputWriter, "%s:\n", node.path)
+		w.sectionsPrinted++
+	}
+	result.diagnostics.Flush()
+
+	if result.err != nil {
+		// Diagnostics go to stderr so they never end up in captured output.
+		// Only the directory given on the command line is a serious failure.
+		level := status.Minor
+		if node.depth == 0 {
+			level = status.Serious
+		}
+		status.ReportError(level, "cannot open directory", node.path, result.err)
+		return
+	}
+
+	if printed && w.options.Flat {
+		w.listFlat(node, result)
+	} else if printed {
+		display.DisplayFiles(result.entries, node.path, result.options.ToMap(), w.outputWriter, w.options.Colorless())
+	}
+}
+
+// subdirectories returns the entries of a directory the walk descends into.
+func (w *walker) subdirectories(node *directoryNode, result scanResult) []*directoryNode {
+	var children []*directoryNode
+	for _, entry := range result.entries {
+		subDirectoryPath := joinDisplayPath(node.path, entry.Name())
+		if w.shouldDescend(entry, subDirectoryPath, node.depth+1) {
+			children = append(children, &directoryNode{path: subDirectoryPath, depth: node.depth + 1, parent: node})
 		}
-		if entryInfo.IsDir() {
-			subDirectoryPath := joinDisplayPath(directoryPath, entry.Name())
-			RecursiveList(subDirectoryPath, optionFlags, captureOutput, outputWriter)
+	}
+	return children
+}
+
+// listFlat prints the entries of one directory as full paths for --flat.
+func (w *walker) listFlat(node *directoryNode, result scanResult) {
+	var flatEntries []fs.DirEntry
+	for _, entry := range result.entries {
+		if entry.Name() != "." && entry.Name() != ".." {
+			flatEntries = append(flatEntries, entry)
 		}
 	}
+	namePrefix := utils.DisplayPath(node.path, w.options.Absolute, w.options.Tilde)
+	if !strings.HasSuffix(namePrefix, "/") {
+		namePrefix += "/"
+	}
+	display.DisplayFlat(flatEntries, node.path, namePrefix, result.options.ToMap(), w.outputWriter, w.options.Colorless(), w.options.LineTerminator())
+}
+
+// shouldDescend reports whether the entry is a directory the walk enters.
+func (w *walker) shouldDescend(entry fs.DirEntry, entryPath string, depth int) bool {
+	if entry.Name() == "." || entry.Name() == ".." {
+		return false
+	}
+	entryInfo, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	return w.descent.Into(entry, entryPath, entryInfo, depth) != nil
 }
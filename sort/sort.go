@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"sort"
 	"strings"
+	"time"
 )
 
 // SortKey returns a string key for sorting file names.
@@ -22,20 +23,96 @@ func SortKey(name string) string {
 	return "4" + strings.ToLower(name)
 }
 
+// modTime returns the modification time of an entry, or the zero time
+// (sorting last) when the entry cannot be stat'ed.
+func modTime(entry fs.DirEntry) time.Time {
+	entryInfo, err := entry.Info()
+	if err != nil {
+		return time.Time{}
+	}
+	return entryInfo.ModTime()
+}
+
+// size returns the size of an entry, or -1 (sorting last) when the entry
+// cannot be stat'ed.
+func size(entry fs.DirEntry) int64 {
+	entryInfo, err := entry.Info()
+	if err != nil {
+		return -1
+	}
+	return entryInfo.Size()
+}
+
+// versionLess reports whether name a sorts before name b when the runs of
+// digits within them are compared as numbers, so "v1.10" follows "v1.9".
+func versionLess(a string, b string) bool {
+	for a != "" && b != "" {
+		aDigits, bDigits := isDigit(a[0]), isDigit(b[0])
+		if aDigits != bDigits {
+			return a < b
+		}
+		aRun, bRun := leadingRun(a, aDigits), leadingRun(b, bDigits)
+		if aDigits {
+			aNumber, bNumber := strings.TrimLeft(aRun, "0"), strings.TrimLeft(bRun, "0")
+			if len(aNumber) != len(bNumber) {
+				return len(aNumber) < len(bNumber)
+			}
+			if aNumber != bNumber {
+				return aNumber < bNumber
+			}
+		} else if aRun != bRun {
+			return aRun < bRun
+		}
+		a, b = a[len(aRun):], b[len(bRun):]
+	}
+	return len(a) < len(b)
+}
+
+// leadingRun returns the digits, or the non-digits, s starts with.
+func leadingRun(s string, digits bool) string {
+	end := 0
+	for end < len(s) && isDigit(s[end]) == digits {
+		end++
+	}
+	return s[:end]
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
 // SortFiles orders file entries based on flags.
 func SortFiles(dirEntries []fs.DirEntry, optionFlags map[string]bool) []fs.DirEntry {
 	// If the "-t" flag is set, sort by modification time (newest first)
 	// with a secondary alphabetical order for files with identical modification times.
-	if optionFlags["t"] {
+	// "-S" sorts by size (largest first) the same way, "-U" keeps directory order
+	// and "-v" compares the numbers within names by value.
+	if optionFlags["U"] {
+		// Leave the entries as the directory returned them.
+	} else if optionFlags["S"] {
 		sort.SliceStable(dirEntries, func(i, j int) bool {
-			entryInfoI, _ := dirEntries[i].Info()
-			entryInfoJ, _ := dirEntries[j].Info()
+			sizeI := size(dirEntries[i])
+			sizeJ := size(dirEntries[j])
+			if sizeI == sizeJ {
+				return SortKey(dirEntries[i].Name()) < SortKey(dirEntries[j].Name())
+			}
+			return sizeI > sizeJ
+		})
+	} else if optionFlags["t"] {
+		sort.SliceStable(dirEntries, func(i, j int) bool {
+			modTimeI := modTime(dirEntries[i])
+			modTimeJ := modTime(dirEntries[j])
 			// If mod times are equal, sort alphabetically.
-			if entryInfoI.ModTime() == entryInfoJ.ModTime() {
+			if modTimeI.Equal(modTimeJ) {
 				return SortKey(dirEntries[i].Name()) < SortKey(dirEntries[j].Name())
 			}
 			// Otherwise, sort by modification time (newest first).
-			return entryInfoI.ModTime().After(entryInfoJ.ModTime())
+			return modTimeI.After(modTimeJ)
+		})
+	} else if optionFlags["v"] {
+		sort.SliceStable(dirEntries, func(i, j int) bool {
+			return versionLess(dirEntries[i].Name(), dirEntries[j].Name())
 		})
 	} else {
 		// Default alphabetical sort based on our custom sort key.
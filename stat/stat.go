@@ -0,0 +1,122 @@
+package stat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"eles/du"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+)
+
+// Record is everything myls stat prints about one file.
+type Record struct {
+	Path        string `json:"path"`
+	Target      string `json:"target,omitempty"` // What a symbolic link points to.
+	Type        string `json:"type"`
+	Size        int64  `json:"size"`
+	Allocated   int64  `json:"allocated"`
+	Mode        string `json:"mode"`
+	Permissions string `json:"permissions"` // Octal, with the setuid, setgid and sticky bits.
+	Owner       string `json:"owner"`
+	UID         uint32 `json:"uid"`
+	Group       string `json:"group"`
+	GID         uint32 `json:"gid"`
+	Links       uint64 `json:"links"`
+	Inode       uint64 `json:"inode"`
+	Device      uint64 `json:"device"`
+	Accessed    string `json:"accessed"`
+	Modified    string `json:"modified"`
+	Changed     string `json:"changed"`
+}
+
+// Run prints the details of each path of options (myls stat): as labelled
+// lines separated by a blank line, or with --format=json as one JSON
+// object per path. Symbolic links are described themselves unless -L is
+// given. A path that cannot be stat'ed is a serious problem.
+func Run(options flags.Options, outputWriter io.Writer) {
+	encoder := json.NewEncoder(outputWriter)
+	encoder.SetEscapeHTML(false)
+	printed := 0
+	for _, filePath := range options.Paths {
+		record, err := newRecord(filePath, options.Dereference)
+		if err != nil {
+			status.ReportError(status.Serious, "cannot stat", filePath, err)
+			continue
+		}
+		if options.Format == "json" {
+			encoder.Encode(record)
+			continue
+		}
+		if printed > 0 {
+			fmt.Fprintln(outputWriter)
+		}
+		printText(record, outputWriter)
+		printed++
+	}
+}
+
+// newRecord describes the file at filePath, or the file it references
+// when dereference is set.
+func newRecord(filePath string, dereference bool) (Record, error) {
+	statFunc := os.Lstat
+	if dereference {
+		statFunc = os.Stat
+	}
+	info, err := statFunc(filePath)
+	if err != nil {
+		return Record{}, err
+	}
+	record := Record{
+		Path:     filePath,
+		Type:     utils.FileTypeName(info.Mode()),
+		Size:     info.Size(),
+		Mode:     utils.GetPermissions(info),
+		Modified: formatTime(info.ModTime()),
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		record.Target, _ = os.Readlink(filePath)
+	}
+	record.Allocated = du.FileSize(info).Allocated
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		record.Permissions = fmt.Sprintf("%04o", stat.Mode&07777)
+		record.UID, record.GID = stat.Uid, stat.Gid
+		record.Owner, record.Group = utils.LookupOwner(stat.Uid), utils.LookupGroup(stat.Gid)
+		record.Links = uint64(stat.Nlink)
+		record.Inode = stat.Ino
+		record.Device = uint64(stat.Dev)
+		record.Accessed = formatTime(time.Unix(stat.Atim.Unix()))
+		record.Changed = formatTime(time.Unix(stat.Ctim.Unix()))
+	}
+	return record, nil
+}
+
+// printText prints a record as labelled lines, the labels aligned on the
+// colon as stat(1) does.
+func printText(record Record, outputWriter io.Writer) {
+	file := record.Path
+	if record.Target != "" {
+		file += " -> " + record.Target
+	}
+	fmt.Fprintf(outputWriter, "  File: %s\n", file)
+	fmt.Fprintf(outputWriter, "  Type: %s\n", record.Type)
+	fmt.Fprintf(outputWriter, "  Size: %d bytes (%d allocated)\n", record.Size, record.Allocated)
+	fmt.Fprintf(outputWriter, "  Mode: %s (%s)\n", record.Mode, record.Permissions)
+	fmt.Fprintf(outputWriter, " Owner: %s (%d)\n", record.Owner, record.UID)
+	fmt.Fprintf(outputWriter, " Group: %s (%d)\n", record.Group, record.GID)
+	fmt.Fprintf(outputWriter, " Links: %d\n", record.Links)
+	fmt.Fprintf(outputWriter, " Inode: %d (device %d)\n", record.Inode, record.Device)
+	fmt.Fprintf(outputWriter, "Access: %s\n", record.Accessed)
+	fmt.Fprintf(outputWriter, "Modify: %s\n", record.Modified)
+	fmt.Fprintf(outputWriter, "Change: %s\n", record.Changed)
+}
+
+// formatTime formats a file time to the nanosecond, with its zone offset.
+func formatTime(fileTime time.Time) string {
+	return fileTime.Format("2006-01-02 15:04:05.000000000 -0700")
+}
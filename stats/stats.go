@@ -0,0 +1,229 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"eles/flags"
+	"eles/walk"
+)
+
+// sizeBuckets are the upper bounds (exclusive) of the size histogram.
+var sizeBuckets = []struct {
+	label string
+	limit int64
+}{
+	{"0 B", 1},
+	{"< 1 KiB", 1 << 10},
+	{"< 10 KiB", 10 << 10},
+	{"< 100 KiB", 100 << 10},
+	{"< 1 MiB", 1 << 20},
+	{"< 10 MiB", 10 << 20},
+	{"< 100 MiB", 100 << 20},
+	{"< 1 GiB", 1 << 30},
+	{">= 1 GiB", 1<<63 - 1},
+}
+
+// ageBuckets are the upper bounds (exclusive) of the modification age histogram.
+var ageBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"< 1 day", 24 * time.Hour},
+	{"< 1 week", 7 * 24 * time.Hour},
+	{"< 1 month", 30 * 24 * time.Hour},
+	{"< 1 year", 365 * 24 * time.Hour},
+	{">= 1 year", 1<<63 - 1},
+}
+
+// Bucket is one bar of a histogram.
+type Bucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// Extension is the number and total size of regular files with one extension.
+type Extension struct {
+	Extension string `json:"extension"`
+	Files     int64  `json:"files"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Report summarises a tree for --stats.
+type Report struct {
+	Roots         []string    `json:"roots"`
+	Files         int64       `json:"files"`
+	Directories   int64       `json:"directories"`
+	Symlinks      int64       `json:"symlinks"`
+	Other         int64       `json:"other"`
+	TotalBytes    int64       `json:"total_bytes"`
+	AverageBytes  int64       `json:"average_bytes"`
+	SizeHistogram []Bucket    `json:"size_histogram"`
+	AgeHistogram  []Bucket    `json:"age_histogram"`
+	Extensions    []Extension `json:"extensions"`
+	DeepestPath   string      `json:"deepest_path"`
+	DeepestDepth  int         `json:"deepest_depth"`
+}
+
+// collector accumulates a Report while the tree is walked.
+type collector struct {
+	report     Report
+	extensions map[string]*Extension
+	now        time.Time
+}
+
+// Collect walks every root with the rules of the listing (-a, --ignore,
+// --hide, --max-depth, --prune, -x, --follow) and summarises what it finds.
+// Roots that are not directories are counted themselves.
+func Collect(roots []string, options flags.Options) Report {
+	statsCollector := &collector{
+		extensions: make(map[string]*Extension),
+		now:        time.Now(),
+	}
+	statsCollector.report.Roots = roots
+	statsCollector.report.SizeHistogram = make([]Bucket, len(sizeBuckets))
+	for index, bucket := range sizeBuckets {
+		statsCollector.report.SizeHistogram[index].Label = bucket.label
+	}
+	statsCollector.report.AgeHistogram = make([]Bucket, len(ageBuckets))
+	for index, bucket := range ageBuckets {
+		statsCollector.report.AgeHistogram[index].Label = bucket.label
+	}
+
+	for _, root := range roots {
+		rootInfo, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		if !rootInfo.IsDir() {
+			statsCollector.add(root, rootInfo, 0)
+			continue
+		}
+		walk.Walk(root, options, statsCollector.add)
+	}
+	return statsCollector.finish()
+}
+
+// add records one file of the tree.
+func (c *collector) add(entryPath string, entryInfo os.FileInfo, depth int) {
+	mode := entryInfo.Mode()
+	switch {
+	case mode.IsDir():
+		c.report.Directories++
+	case mode&os.ModeSymlink != 0:
+		c.report.Symlinks++
+	case mode.IsRegular():
+		c.report.Files++
+		c.addFile(entryPath, entryInfo)
+	default:
+		c.report.Other++
+	}
+	if depth > c.report.DeepestDepth || c.report.DeepestPath == "" {
+		c.report.DeepestDepth = depth
+		c.report.DeepestPath = entryPath
+	}
+}
+
+// addFile records the size, age and extension of one regular file.
+func (c *collector) addFile(entryPath string, entryInfo os.FileInfo) {
+	size := entryInfo.Size()
+	c.report.TotalBytes += size
+	for index, bucket := range sizeBuckets {
+		if size < bucket.limit {
+			c.report.SizeHistogram[index].Count++
+			break
+		}
+	}
+
+	age := c.now.Sub(entryInfo.ModTime())
+	for index, bucket := range ageBuckets {
+		if age < bucket.limit {
+			c.report.AgeHistogram[index].Count++
+			break
+		}
+	}
+
+	extension := strings.ToLower(filepath.Ext(filepath.Base(entryPath)))
+	if extension == "" || extension == filepath.Base(entryPath) {
+		extension = "(none)"
+	}
+	byExtension, ok := c.extensions[extension]
+	if !ok {
+		byExtension = &Extension{Extension: extension}
+		c.extensions[extension] = byExtension
+	}
+	byExtension.Files++
+	byExtension.Bytes += size
+}
+
+// finish computes the derived figures and orders the extensions by file count.
+func (c *collector) finish() Report {
+	if c.report.Files > 0 {
+		c.report.AverageBytes = c.report.TotalBytes / c.report.Files
+	}
+	for _, byExtension := range c.extensions {
+		c.report.Extensions = append(c.report.Extensions, *byExtension)
+	}
+	sort.Slice(c.report.Extensions, func(i, j int) bool {
+		if c.report.Extensions[i].Files != c.report.Extensions[j].Files {
+			return c.report.Extensions[i].Files > c.report.Extensions[j].Files
+		}
+		return c.report.Extensions[i].Extension < c.report.Extensions[j].Extension
+	})
+	return c.report
+}
+
+// Print writes the report in the given format: "text" or "json".
+func Print(report Report, format string, outputWriter io.Writer) {
+	if format == "json" {
+		encoder := json.NewEncoder(outputWriter)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+		return
+	}
+
+	fmt.Fprintf(outputWriter, "Statistics for %s\n", strings.Join(report.Roots, ", "))
+	fmt.Fprintf(outputWriter, "  files:        %d\n", report.Files)
+	fmt.Fprintf(outputWriter, "  directories:  %d\n", report.Directories)
+	fmt.Fprintf(outputWriter, "  symlinks:     %d\n", report.Symlinks)
+	fmt.Fprintf(outputWriter, "  other:        %d\n", report.Other)
+	fmt.Fprintf(outputWriter, "  total size:   %d bytes\n", report.TotalBytes)
+	fmt.Fprintf(outputWriter, "  average size: %d bytes\n", report.AverageBytes)
+	if report.DeepestPath != "" {
+		fmt.Fprintf(outputWriter, "  deepest path: %s (depth %d)\n", report.DeepestPath, report.DeepestDepth)
+	}
+
+	fmt.Fprintln(outputWriter, "\nFile sizes:")
+	printHistogram(report.SizeHistogram, report.Files, outputWriter)
+	fmt.Fprintln(outputWriter, "\nModification age:")
+	printHistogram(report.AgeHistogram, report.Files, outputWriter)
+
+	// The text report keeps to the most common extensions; JSON has them all.
+	fmt.Fprintln(outputWriter, "\nExtensions:")
+	for index, byExtension := range report.Extensions {
+		if index == 10 {
+			fmt.Fprintf(outputWriter, "  ... %d more\n", len(report.Extensions)-index)
+			break
+		}
+		fmt.Fprintf(outputWriter, "  %-12s %8d files %14d bytes\n", byExtension.Extension, byExtension.Files, byExtension.Bytes)
+	}
+}
+
+// printHistogram prints one histogram with bars scaled to 40 characters.
+func printHistogram(buckets []Bucket, total int64, outputWriter io.Writer) {
+	for _, bucket := range buckets {
+		bar := 0
+		if total > 0 {
+			bar = int(bucket.Count * 40 / total)
+		}
+		line := fmt.Sprintf("  %-10s %8d %s", bucket.Label, bucket.Count, strings.Repeat("#", bar))
+		fmt.Fprintln(outputWriter, strings.TrimRight(line, " "))
+	}
+}
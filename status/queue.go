@@ -0,0 +1,50 @@
+package status
+
+import "sync"
+
+// Queue holds the diagnostics of work done ahead of the output it belongs
+// to, such as a directory read by a worker before its section is printed,
+// until Flush reports them with that output. A nil Queue reports at once.
+type Queue struct {
+	mutex       sync.Mutex
+	diagnostics []queuedDiagnostic
+}
+
+// queuedDiagnostic is the arguments of one Report call held by a Queue.
+type queuedDiagnostic struct {
+	level     int
+	operation string
+	path      string
+	reason    string
+}
+
+// Report queues a diagnostic, or reports it at once when q is nil.
+func (q *Queue) Report(level int, operation string, path string, reason string) {
+	if q == nil {
+		Report(level, operation, path, reason)
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.diagnostics = append(q.diagnostics, queuedDiagnostic{level, operation, path, reason})
+}
+
+// ReportError queues err for path like the package's ReportError.
+func (q *Queue) ReportError(level int, operation string, path string, err error) {
+	q.Report(level, operation, path, Describe(err))
+}
+
+// Flush reports the queued diagnostics in the order they were found and
+// empties the queue.
+func (q *Queue) Flush() {
+	if q == nil {
+		return
+	}
+	q.mutex.Lock()
+	diagnostics := q.diagnostics
+	q.diagnostics = nil
+	q.mutex.Unlock()
+	for _, diagnostic := range diagnostics {
+		Report(diagnostic.level, diagnostic.operation, diagnostic.path, diagnostic.reason)
+	}
+}
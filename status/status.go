@@ -0,0 +1,122 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Exit statuses, as documented for GNU ls.
+const (
+	Warning = 0 // reported without changing the exit status
+	Minor   = 1 // e.g. a subdirectory could not be read
+	Serious = 2 // e.g. a command line argument could not be accessed
+)
+
+var (
+	mutex       sync.Mutex
+	exitCode    int
+	jsonMode    bool
+	flushOutput func()
+)
+
+// jsonDiagnostic is one line of --errors=json output.
+type jsonDiagnostic struct {
+	Operation string `json:"operation,omitempty"`
+	Path      string `json:"path"`
+	Error     string `json:"error"`
+	Level     string `json:"level"`
+}
+
+// SetFormat selects how diagnostics are written: "text" (GNU style) or "json".
+func SetFormat(format string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	jsonMode = format == "json"
+}
+
+// SetFlush registers the function that writes out buffered output. It is
+// called before each diagnostic, so the listing printed before a problem
+// appears before its report.
+func SetFlush(flush func()) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	flushOutput = flush
+}
+
+// ExitCode returns the most serious status reported so far.
+func ExitCode() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return exitCode
+}
+
+// Raise raises the exit status to level without a diagnostic, for outcomes
+// that are not problems, such as the differences myls diff finds.
+func Raise(level int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if level > exitCode {
+		exitCode = level
+	}
+}
+
+// Report writes a diagnostic to stderr and raises the exit status to level.
+// The text form is "my-ls: operation 'path': reason", or "my-ls: path: reason"
+// when there is no operation.
+func Report(level int, operation string, path string, reason string) {
+	mutex.Lock()
+	flush := flushOutput
+	mutex.Unlock()
+	if flush != nil {
+		flush()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if level > exitCode {
+		exitCode = level
+	}
+
+	if jsonMode {
+		levelName := "minor"
+		if level >= Serious {
+			levelName = "serious"
+		} else if level == Warning {
+			levelName = "warning"
+		}
+		line, _ := json.Marshal(jsonDiagnostic{Operation: operation, Path: path, Error: reason, Level: levelName})
+		fmt.Fprintf(os.Stderr, "%s\n", line)
+		return
+	}
+	if operation == "" {
+		fmt.Fprintf(os.Stderr, "my-ls: %s: %s\n", path, reason)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "my-ls: %s '%s': %s\n", operation, path, reason)
+}
+
+// ReportError reports err for path, describing it the way strerror does.
+func ReportError(level int, operation string, path string, err error) {
+	Report(level, operation, path, Describe(err))
+}
+
+// Describe returns the system error message of err without the path and
+// operation Go adds, e.g. "Permission denied".
+func Describe(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		message := errno.Error()
+		return strings.ToUpper(message[:1]) + message[1:]
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,89 @@
+package top
+
+import (
+	"container/heap"
+	"os"
+	"sort"
+	"syscall"
+
+	"eles/flags"
+	"eles/walk"
+)
+
+// Entry is a file retained by Find, with the value it was ranked by.
+type Entry struct {
+	Path string
+	Info os.FileInfo
+	key  int64
+}
+
+// entryHeap is a min-heap on key: the weakest of the current winners sits
+// at the top, ready to be replaced by a stronger candidate.
+type entryHeap []Entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].key < h[j].key }
+func (h entryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x any)        { *h = append(*h, x.(Entry)) }
+func (h *entryHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// rankKey returns the value a file is ranked by: its size, or its
+// modification or access time in nanoseconds.
+func rankKey(info os.FileInfo, by string) int64 {
+	switch by {
+	case "mtime":
+		return info.ModTime().UnixNano()
+	case "atime":
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			return stat.Atim.Nano()
+		}
+		return info.ModTime().UnixNano()
+	}
+	return info.Size()
+}
+
+// Find returns the count largest (or newest) files below the roots,
+// largest first, ranked by "size", "mtime" or "atime". The trees are
+// walked with the rules of the listing, and only count files are held
+// in memory however large the trees are. Directories are not ranked.
+func Find(roots []string, count int, by string, options flags.Options) []Entry {
+	winners := &entryHeap{}
+	consider := func(entryPath string, entryInfo os.FileInfo, depth int) {
+		if entryInfo.IsDir() {
+			return
+		}
+		candidate := Entry{Path: entryPath, Info: entryInfo, key: rankKey(entryInfo, by)}
+		if winners.Len() < count {
+			heap.Push(winners, candidate)
+		} else if candidate.key > (*winners)[0].key {
+			(*winners)[0] = candidate
+			heap.Fix(winners, 0)
+		}
+	}
+
+	for _, root := range roots {
+		rootInfo, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		if rootInfo.IsDir() {
+			walk.Walk(root, options, consider)
+		} else {
+			consider(root, rootInfo, 0)
+		}
+	}
+
+	ranked := []Entry(*winners)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].key != ranked[j].key {
+			return ranked[i].key > ranked[j].key
+		}
+		return ranked[i].Path < ranked[j].Path
+	})
+	return ranked
+}
@@ -0,0 +1,134 @@
+package tree
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"eles/colorize"
+	"eles/dirconfig"
+	"eles/display"
+	"eles/flags"
+	"eles/recursive"
+	"eles/status"
+	"eles/utils"
+	"eles/walk"
+)
+
+// Run prints each path of options as an indented tree (myls tree),
+// followed by the number of directories and files it shows. Entries are
+// read, filtered and sorted as a recursive listing reads them, with the
+// .mylsrc preferences of each directory.
+func Run(options flags.Options, outputWriter io.Writer) {
+	for index, rootPath := range options.Paths {
+		rootInfo, err := os.Stat(rootPath)
+		if err != nil {
+			status.ReportError(status.Serious, "cannot access", rootPath, err)
+			continue
+		}
+		if index > 0 {
+			fmt.Fprintln(outputWriter)
+		}
+		fmt.Fprintln(outputWriter, colorize.ColorizePath(rootPath, rootInfo, options.Colorless()))
+
+		printer := &printer{
+			options:      options,
+			outputWriter: outputWriter,
+			descent:      walk.Descent{Options: options, RootDevice: utils.DeviceID(rootInfo)},
+			ancestors:    make(walk.Ancestors),
+		}
+		if rootInfo.IsDir() && printer.ancestors.Enter(rootInfo) {
+			printer.printDirectory(rootPath, "", 1)
+		}
+		fmt.Fprintf(outputWriter, "\n%s, %s\n", plural(printer.directories, "directory", "directories"), plural(printer.files, "file", "files"))
+	}
+}
+
+// printer holds the state of one tree.
+type printer struct {
+	options      flags.Options
+	outputWriter io.Writer
+	descent      walk.Descent
+	ancestors    walk.Ancestors
+	directories  int
+	files        int
+}
+
+// printDirectory prints the entries of a directory at depth, each line
+// starting with prefix, and descends into its subdirectories. A
+// subdirectory that leads back to one of its ancestors is reported and
+// not entered, as a recursive listing does.
+func (p *printer) printDirectory(directoryPath string, prefix string, depth int) {
+	options := dirconfig.Apply(directoryPath, p.options)
+	dirEntries, err := recursive.ReadDirectory(directoryPath, options)
+	if err != nil {
+		status.ReportError(status.Minor, "cannot open directory", directoryPath, err)
+		return
+	}
+
+	// The entries are gathered first: the last one shown gets a different
+	// connector.
+	var shownEntries []shownEntry
+	for _, entry := range dirEntries {
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		entryPath := filepath.Join(directoryPath, entry.Name())
+		entryInfo, err := entry.Info()
+		if err != nil {
+			status.ReportError(status.Minor, "cannot access", entryPath, err)
+			continue
+		}
+		targetInfo := p.descent.Into(entry, entryPath, entryInfo, depth)
+		if p.options.DirsOnly && !entryInfo.IsDir() && targetInfo == nil {
+			continue
+		}
+		shownEntries = append(shownEntries, shownEntry{entry, entryPath, entryInfo, targetInfo})
+	}
+
+	optionFlags := options.ToMap()
+	for index, shown := range shownEntries {
+		connector, indent := "├── ", "│   "
+		if index == len(shownEntries)-1 {
+			connector, indent = "└── ", "    "
+		}
+		name := display.EntryName(shown.entry, shown.info, directoryPath, optionFlags, p.options.Colorless())
+		// The --count value of a directory follows its name, e.g. "spool [12]".
+		if counted, ok := shown.entry.(interface{ ChildCount() string }); ok {
+			name += " [" + counted.ChildCount() + "]"
+		}
+		fmt.Fprintln(p.outputWriter, prefix+connector+name)
+
+		entered := shown.directoryInfo != nil && p.ancestors.Enter(shown.directoryInfo)
+		if shown.directoryInfo != nil && !entered {
+			walk.ReportLoop(shown.path)
+		}
+		if shown.info.IsDir() || entered {
+			p.directories++
+		} else {
+			p.files++
+		}
+		if entered {
+			p.printDirectory(shown.path, prefix+indent, depth+1)
+			p.ancestors.Leave(shown.directoryInfo)
+		}
+	}
+}
+
+// shownEntry is an entry of a directory the tree prints.
+type shownEntry struct {
+	entry         fs.DirEntry
+	path          string
+	info          os.FileInfo
+	directoryInfo os.FileInfo // The directory it leads to, nil when the options leave its contents out.
+}
+
+// plural returns count followed by the singular or plural noun.
+func plural(count int, singular string, pluralForm string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, pluralForm)
+}
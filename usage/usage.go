@@ -0,0 +1,141 @@
+package usage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"eles/du"
+	"eles/flags"
+	"eles/utils"
+	"eles/walk"
+	"eles/width"
+)
+
+// Account is the space used by one owner or group.
+type Account struct {
+	Name      string `json:"name"`
+	Files     int64  `json:"files"`
+	Apparent  int64  `json:"apparent"`
+	Allocated int64  `json:"allocated"`
+}
+
+// Collect walks the roots and totals the files of every owner, or of every
+// group when by is "group". Every file is counted whatever the listing
+// hides, hard-linked files once, and directories only for their own size.
+func Collect(roots []string, by string, options flags.Options) []Account {
+	accounts := make(map[uint32]*Account)
+	inodes := du.NewInodeSet()
+	add := func(entryPath string, entryInfo os.FileInfo, depth int) {
+		stat, ok := entryInfo.Sys().(*syscall.Stat_t)
+		if !ok || !inodes.FirstVisit(entryInfo) {
+			return
+		}
+		id, name := stat.Uid, ""
+		if by == "group" {
+			id = stat.Gid
+		}
+		account, ok := accounts[id]
+		if !ok {
+			if by == "group" {
+				name = utils.LookupGroup(id)
+			} else {
+				name = utils.LookupOwner(id)
+			}
+			account = &Account{Name: name}
+			accounts[id] = account
+		}
+		if !entryInfo.IsDir() {
+			account.Files++
+		}
+		size := du.FileSize(entryInfo)
+		account.Apparent += size.Apparent
+		account.Allocated += size.Allocated
+	}
+
+	measureOptions := du.MeasureOptions(options)
+	for _, root := range roots {
+		rootInfo, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		if rootInfo.IsDir() {
+			walk.Walk(root, measureOptions, add)
+		} else {
+			add(root, rootInfo, 0)
+		}
+	}
+
+	var result []Account
+	for _, account := range accounts {
+		result = append(result, *account)
+	}
+	return result
+}
+
+// Sort orders accounts by "bytes" (apparent size), "allocated" or "files",
+// largest first, or by "name". Ties are broken by name.
+func Sort(accounts []Account, by string) {
+	key := func(account Account) int64 {
+		switch by {
+		case "allocated":
+			return account.Allocated
+		case "files":
+			return account.Files
+		}
+		return account.Apparent
+	}
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if by != "name" && key(accounts[i]) != key(accounts[j]) {
+			return key(accounts[i]) > key(accounts[j])
+		}
+		return accounts[i].Name < accounts[j].Name
+	})
+}
+
+// Print writes the accounts as a "table", "csv" or "json". The heading
+// names the first column after by: OWNER or GROUP.
+func Print(accounts []Account, by string, format string, outputWriter io.Writer) {
+	heading := "OWNER"
+	if by == "group" {
+		heading = "GROUP"
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(outputWriter)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if accounts == nil {
+			accounts = []Account{}
+		}
+		encoder.Encode(accounts)
+	case "csv":
+		csvWriter := csv.NewWriter(outputWriter)
+		csvWriter.Write([]string{heading, "FILES", "APPARENT", "ALLOCATED"})
+		for _, account := range accounts {
+			csvWriter.Write([]string{
+				account.Name,
+				strconv.FormatInt(account.Files, 10),
+				strconv.FormatInt(account.Apparent, 10),
+				strconv.FormatInt(account.Allocated, 10),
+			})
+		}
+		csvWriter.Flush()
+	default:
+		// Names are padded by display width, so wide characters line up.
+		nameWidth := width.StringWidth(heading)
+		for _, account := range accounts {
+			nameWidth = max(nameWidth, width.StringWidth(account.Name))
+		}
+		fmt.Fprintf(outputWriter, "%s %10s %14s %14s\n", width.PadRight(heading, nameWidth), "FILES", "APPARENT", "ALLOCATED")
+		for _, account := range accounts {
+			fmt.Fprintf(outputWriter, "%s %10d %14d %14d\n", width.PadRight(account.Name, nameWidth), account.Files, account.Apparent, account.Allocated)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"io/fs"   
 	"os"      
 	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall" 
 )
 
@@ -52,20 +55,7 @@ func GetPermissions(info os.FileInfo) string {
 
 	
 	// Determine the file type indicator.
-	switch {
-	case mode&os.ModeSymlink != 0:
-		perms = "l" // Symbolic link.
-	case mode.IsDir():
-		perms = "d" // Directory.
-	case mode&os.ModeDevice != 0:
-		if mode&os.ModeCharDevice != 0 {
-			perms = "c" // Character device.
-		} else {
-			perms = "b" // Block device.
-		}
-	default:
-		perms = "-" // Regular file.
-	}
+	perms = GetFileType(mode)
 
 	
 	// Owner permissions.
@@ -149,19 +139,192 @@ func GetPermissions(info os.FileInfo) string {
 	return perms
 }
 
+// Returns the one-letter file type used as the first character of the permissions.
+func GetFileType(mode fs.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "l" // Symbolic link.
+	case mode.IsDir():
+		return "d" // Directory.
+	case mode&os.ModeDevice != 0:
+		if mode&os.ModeCharDevice != 0 {
+			return "c" // Character device.
+		}
+		return "b" // Block device.
+	case mode&os.ModeNamedPipe != 0:
+		return "p" // Named pipe.
+	case mode&os.ModeSocket != 0:
+		return "s" // Socket.
+	default:
+		return "-" // Regular file.
+	}
+}
+
+// Returns the name of the file type used by structured output (JSON and
+// CSV records, stat and diff): file, directory, symlink, char-device,
+// block-device, fifo or socket.
+func FileTypeName(mode fs.FileMode) string {
+	return fileTypeNames[GetFileType(mode)]
+}
+
+// fileTypeNames names the file types of GetFileType.
+var fileTypeNames = map[string]string{
+	"-": "file",
+	"d": "directory",
+	"l": "symlink",
+	"c": "char-device",
+	"b": "block-device",
+	"p": "fifo",
+	"s": "socket",
+}
+
 // Retrieves and returns the owner username for the file based on its UID.
 func GetOwner(info os.FileInfo) string {
-	stat := info.Sys().(*syscall.Stat_t)     // Convert system-specific data to *syscall.Stat_t.
-	uid := stat.Uid                          // Retrieve the UID from the stat.
-	usr, _ := user.LookupId(fmt.Sprint(uid)) // Look up the username using the UID.
-	return usr.Username                      // Return the username.
+	stat := info.Sys().(*syscall.Stat_t) // Convert system-specific data to *syscall.Stat_t.
+	return LookupOwner(stat.Uid)
+}
+
+// Caches of resolved user and group names; lookups are slow and the same
+// few ids repeat across a listing.
+var (
+	nameCacheMutex sync.Mutex
+	ownerNames     = make(map[uint32]string)
+	groupNames     = make(map[uint32]string)
+)
+
+// Returns the username for a UID, or the number itself when the UID has
+// no passwd entry (as GNU ls does).
+func LookupOwner(uid uint32) string {
+	nameCacheMutex.Lock()
+	defer nameCacheMutex.Unlock()
+	if name, ok := ownerNames[uid]; ok {
+		return name
+	}
+	name := fmt.Sprint(uid)
+	if usr, err := user.LookupId(name); err == nil {
+		name = usr.Username
+	}
+	ownerNames[uid] = name
+	return name
+}
+
+// Returns the group name for a GID, or the number itself when the GID has
+// no group entry.
+func LookupGroup(gid uint32) string {
+	nameCacheMutex.Lock()
+	defer nameCacheMutex.Unlock()
+	if name, ok := groupNames[gid]; ok {
+		return name
+	}
+	name := fmt.Sprint(gid)
+	if grp, err := user.LookupGroupId(name); err == nil {
+		name = grp.Name
+	}
+	groupNames[gid] = name
+	return name
 }
 
 
 // Retrieves and returns the group name for the file based on its GID.
 func GetGroup(info os.FileInfo) string {
-	stat := info.Sys().(*syscall.Stat_t)          // Convert system-specific data to *syscall.Stat_t.
-	gid := stat.Gid                               // Retrieve the GID from the stat.
-	grp, _ := user.LookupGroupId(fmt.Sprint(gid)) // Look up the group name using the GID.
-	return grp.Name                               // Return the group name.
+	stat := info.Sys().(*syscall.Stat_t) // Convert system-specific data to *syscall.Stat_t.
+	return LookupGroup(stat.Gid)
+}
+
+// maxLinkHops bounds symbolic link resolution like the kernel's MAXSYMLINKS.
+const maxLinkHops = 40
+
+// LinkChain describes the result of following a symbolic link to its end.
+type LinkChain struct {
+	Targets   []string    // Each raw link target, in the order they were followed.
+	Paths     []string    // The path each target resolves to, relative to its link.
+	FinalPath string      // Path of the last element in the chain.
+	FinalInfo os.FileInfo // Lstat of FinalPath, nil when it does not exist.
+	Dangling  bool        // The chain ends at a missing file.
+	Loop      bool        // The chain never ends (or exceeds maxLinkHops).
+}
+
+// Follows the symbolic link at linkPath hop by hop and records every target.
+func ResolveLink(linkPath string) LinkChain {
+	var chain LinkChain
+	visited := map[string]bool{linkPath: true}
+	currentPath := linkPath
+
+	for hop := 0; hop < maxLinkHops; hop++ {
+		target, err := os.Readlink(currentPath)
+		if err != nil {
+			chain.Dangling = true
+			return chain
+		}
+		chain.Targets = append(chain.Targets, target)
+		if filepath.IsAbs(target) {
+			currentPath = target
+		} else {
+			currentPath = filepath.Join(filepath.Dir(currentPath), target)
+		}
+		chain.Paths = append(chain.Paths, currentPath)
+		chain.FinalPath = currentPath
+
+		info, err := os.Lstat(currentPath)
+		if err != nil {
+			chain.Dangling = true
+			return chain
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			chain.FinalInfo = info
+			return chain
+		}
+		if visited[currentPath] {
+			chain.Loop = true
+			return chain
+		}
+		visited[currentPath] = true
+	}
+	chain.Loop = true
+	return chain
+}
+
+// Returns the id of the device holding the file, used to detect mount points.
+func DeviceID(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
+
+// Identifies a file by device and inode, independent of the path used to reach it.
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// Returns the device and inode pair of the file.
+func GetFileID(info os.FileInfo) FileID {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return FileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}
+	}
+	return FileID{}
+}
+
+// Returns path as shown by --flat: unchanged, made absolute, or absolute
+// with the home directory abbreviated to "~".
+func DisplayPath(path string, absolute bool, tilde bool) string {
+	if !absolute && !tilde {
+		return path
+	}
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if tilde {
+		if home, err := os.UserHomeDir(); err == nil && home != "/" {
+			if absolutePath == home {
+				return "~"
+			}
+			if strings.HasPrefix(absolutePath, home+"/") {
+				return "~" + absolutePath[len(home):]
+			}
+		}
+	}
+	return absolutePath
 }
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Workers bounds the goroutines working at once to --jobs, across nested
+// work: a worker reading a directory hands the measuring of its
+// subdirectories to idle workers and does the rest itself, so the bound
+// holds however deep the work nests. A nil Workers does everything in the
+// calling goroutine.
+type Workers chan struct{}
+
+// NewWorkers returns room for jobs workers, one per CPU when jobs is 0.
+func NewWorkers(jobs int) Workers {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	return make(Workers, jobs)
+}
+
+// Acquire waits for an idle worker and takes it.
+func (w Workers) Acquire() {
+	w <- struct{}{}
+}
+
+// Release gives back a worker taken with Acquire.
+func (w Workers) Release() {
+	<-w
+}
+
+// Go runs work on an idle worker, or in the calling goroutine when every
+// worker is busy, and tracks it in group. It never waits for a worker, so
+// a worker handing out work cannot be left waiting on its own pool.
+func (w Workers) Go(group *sync.WaitGroup, work func()) {
+	select {
+	case w <- struct{}{}:
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			defer w.Release()
+			work()
+		}()
+	default:
+		work()
+	}
+}
@@ -0,0 +1,77 @@
+package walk
+
+import (
+	"io/fs"
+	"os"
+
+	"eles/filter"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+)
+
+// Descent decides which directories a walk of a tree enters, with the rules
+// of a recursive listing: --follow (or -L), --max-depth, --prune and -x.
+type Descent struct {
+	Options    flags.Options
+	RootDevice uint64 // Device of the walked path, for -x.
+}
+
+// Into returns the directory information of an entry the walk enters, the
+// target's for a followed symbolic link, or nil when it is not a directory
+// or the options leave it out. The entry is depth levels below the walked
+// path.
+func (d Descent) Into(entry fs.DirEntry, entryPath string, entryInfo os.FileInfo, depth int) os.FileInfo {
+	if entry.Type()&os.ModeSymlink != 0 {
+		if !d.Options.Follow {
+			return nil
+		}
+		// Resolution is bounded, so long or circular chains are not entered.
+		chain := utils.ResolveLink(entryPath)
+		if chain.Dangling || chain.Loop {
+			return nil
+		}
+		entryInfo = chain.FinalInfo
+	}
+	if !entryInfo.IsDir() {
+		return nil
+	}
+	if d.Options.MaxDepth >= 0 && depth > d.Options.MaxDepth {
+		return nil
+	}
+	// A pruned directory is still shown by its parent, just not entered.
+	if filter.Pruned(entryPath, d.Options.Prune) {
+		return nil
+	}
+	if d.Options.OneFileSystem && utils.DeviceID(entryInfo) != d.RootDevice {
+		return nil
+	}
+	return entryInfo
+}
+
+// Ancestors holds the directories a walk is inside of, from the walked path
+// down, so a directory leading back to one of them through a symbolic link
+// or bind mount is not entered again.
+type Ancestors map[utils.FileID]bool
+
+// Enter adds a directory the walk goes into, or reports false when it is
+// already one of the ancestors.
+func (a Ancestors) Enter(directoryInfo os.FileInfo) bool {
+	directoryID := utils.GetFileID(directoryInfo)
+	if a[directoryID] {
+		return false
+	}
+	a[directoryID] = true
+	return true
+}
+
+// Leave removes a directory the walk is done with.
+func (a Ancestors) Leave(directoryInfo os.FileInfo) {
+	delete(a, utils.GetFileID(directoryInfo))
+}
+
+// ReportLoop reports a directory that is not entered because it is one of
+// its own ancestors, with the message of GNU ls -R.
+func ReportLoop(directoryPath string) {
+	status.Report(status.Serious, "", directoryPath, "not listing already-listed directory")
+}
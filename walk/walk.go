@@ -0,0 +1,83 @@
+package walk
+
+import (
+	"os"
+	"path/filepath"
+
+	"eles/filter"
+	"eles/flags"
+	"eles/status"
+	"eles/utils"
+)
+
+// VisitFunc is called for every entry below the walked directory, with the
+// entry's lstat information (or its target's with -L) and its depth, the
+// direct children of the root being at depth 1.
+type VisitFunc func(entryPath string, entryInfo os.FileInfo, depth int)
+
+// Walk visits everything below rootPath, applying the same rules as a
+// recursive listing: the -a, -L, --ignore and --hide filters, --max-depth, --prune, -x and
+// --follow, with directories that lead back to an ancestor skipped.
+// Unreadable directories are reported as minor problems.
+func Walk(rootPath string, options flags.Options, visit VisitFunc) {
+	WalkQueued(rootPath, options, nil, visit)
+}
+
+// WalkQueued is Walk with the problems it finds held in diagnostics, for a
+// walk done ahead of the output it belongs to.
+func WalkQueued(rootPath string, options flags.Options, diagnostics *status.Queue, visit VisitFunc) {
+	rootInfo, err := os.Stat(rootPath)
+	if err != nil {
+		diagnostics.ReportError(status.Minor, "cannot access", rootPath, err)
+		return
+	}
+	treeWalker := &walker{
+		options:     options,
+		visit:       visit,
+		diagnostics: diagnostics,
+		descent:     Descent{Options: options, RootDevice: utils.DeviceID(rootInfo)},
+		ancestors:   make(Ancestors),
+	}
+	treeWalker.walk(rootPath, rootInfo, 0)
+}
+
+// walker holds the state of one Walk call.
+type walker struct {
+	options     flags.Options
+	visit       VisitFunc
+	diagnostics *status.Queue
+	descent     Descent
+	ancestors   Ancestors
+}
+
+// walk visits the entries of one directory and descends into its subdirectories.
+func (w *walker) walk(directoryPath string, directoryInfo os.FileInfo, depth int) {
+	if !w.ancestors.Enter(directoryInfo) {
+		return
+	}
+	defer w.ancestors.Leave(directoryInfo)
+
+	dirEntries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		w.diagnostics.ReportError(status.Minor, "cannot read directory", directoryPath, err)
+		return
+	}
+	dirEntries = filter.Apply(dirEntries, w.options, directoryPath)
+
+	for _, entry := range dirEntries {
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		entryPath := filepath.Join(directoryPath, entry.Name())
+		entryInfo, err := entry.Info()
+		if err != nil {
+			w.diagnostics.ReportError(status.Minor, "cannot access", entryPath, err)
+			continue
+		}
+		w.visit(entryPath, entryInfo, depth+1)
+
+		if targetInfo := w.descent.Into(entry, entryPath, entryInfo, depth+1); targetInfo != nil {
+			w.walk(entryPath, targetInfo, depth+1)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package width
+
+import "testing"
+
+func TestStringWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ASCII", "report.txt", 10},
+		{"control characters", "a\tb\x7f", 2},
+		{"CJK", "日本語", 6},
+		{"CJK mixed with ASCII", "ab日本cd", 8},
+		{"fullwidth forms", "ＡＢ", 4},
+		{"Hangul syllables", "한국", 4},
+		{"Hangul jamo", "\u1100\u1161\u11A8", 2},
+		{"combining acute", "e\u0301", 1},
+		{"several combining marks", "a\u0300\u0301\u0302b", 2},
+		{"emoji", "🎉", 2},
+		{"ZWJ family", "\U0001F468\u200D\U0001F469\u200D\U0001F467\u200D\U0001F466", 2},
+		{"ZWJ profession with VS16", "\U0001F469\u200D\u2695\uFE0F", 2},
+		{"ZWJ with narrow emoji", "\U0001F3C3\u200D\u2640\uFE0F", 2},
+		{"ZWJ between letters", "x\u200Dy", 2},
+		{"ZWJ between letter and emoji", "x\u200D\U0001F469", 3},
+		{"ZWJ between emoji and letter", "\U0001F469\u200Dx", 3},
+		{"trailing ZWJ", "\U0001F469\u200D", 2},
+		{"flag", "🇫🇷", 2},
+		{"two flags", "🇫🇷🇩🇪", 4},
+		{"lone regional indicator", "🇫", 2},
+		{"VS16 widens narrow emoji", "\u2764\uFE0F", 2},
+		{"VS16 on wide emoji", "\u231A\uFE0F", 2},
+		{"narrow emoji without VS16", "\u2764", 1},
+		{"ANSI color", "\033[01;34mdir\033[0m", 3},
+		{"ANSI around CJK", "\033[31m日本\033[0m", 4},
+		{"lone escape", "\033x", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := StringWidth(test.s); got != test.want {
+				t.Errorf("StringWidth(%q) = %d, want %d", test.s, got, test.want)
+			}
+		})
+	}
+}
+
+func TestStringWidthAmbiguous(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		narrow int
+		wide   int
+	}{
+		{"Greek", "αβγ", 3, 6},
+		{"Cyrillic", "Жж", 2, 4},
+		{"section sign", "§1", 2, 3},
+		{"box drawing", "─│", 2, 4},
+		{"ASCII", "abc", 3, 3},
+		{"CJK", "日本", 4, 4},
+	}
+	t.Cleanup(func() { SetAmbiguousWide(false) })
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetAmbiguousWide(false)
+			if got := StringWidth(test.s); got != test.narrow {
+				t.Errorf("narrow: StringWidth(%q) = %d, want %d", test.s, got, test.narrow)
+			}
+			SetAmbiguousWide(true)
+			if got := StringWidth(test.s); got != test.wide {
+				t.Errorf("wide: StringWidth(%q) = %d, want %d", test.s, got, test.wide)
+			}
+		})
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		s       string
+		columns int
+		right   string
+		left    string
+	}{
+		{"ab", 4, "ab  ", "  ab"},
+		{"日本", 6, "日本  ", "  日本"},
+		{"é", 3, "é  ", "  é"},
+		{"\033[31mab\033[0m", 3, "\033[31mab\033[0m ", " \033[31mab\033[0m"},
+		{"toolong", 3, "toolong", "toolong"},
+	}
+	for _, test := range tests {
+		if got := PadRight(test.s, test.columns); got != test.right {
+			t.Errorf("PadRight(%q, %d) = %q, want %q", test.s, test.columns, got, test.right)
+		}
+		if got := PadLeft(test.s, test.columns); got != test.left {
+			t.Errorf("PadLeft(%q, %d) = %q, want %q", test.s, test.columns, got, test.left)
+		}
+	}
+}